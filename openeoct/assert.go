@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Assertion "class", a rule on the response of an endpoint beyond the schema validation.
+// The selector is a JSON pointer (e.g. "/collections/0/id") or a JSONPath (e.g. "$.collections[*].id"),
+// the operator is one of ASSERT_OPERATORS.
+type Assertion struct {
+	Selector string
+	Operator string
+	Value    interface{}
+}
+
+// Operators of assertions and their checks of the selected values.
+// Returns a message for every value not fulfilling the assertion, keyed by its JSON pointer.
+var ASSERT_OPERATORS = map[string]func(selection []Selected, value interface{}) (map[string]string, error){
+	"equals":   assertEquals,
+	"contains": assertContains,
+	"matches":  assertMatches,
+	"count":    assertCount,
+	"type":     assertType,
+	"exists":   assertExists,
+}
+
+// Selected "class", a value of the response body selected by an assertion, with its location as JSON pointer
+type Selected struct {
+	Pointer string
+	Value   interface{}
+}
+
+// Loads the variables into the selector and string values of the assertions
+func loadVariablesToAssertions(assertions []Assertion, variables map[string]string) []Assertion {
+	loaded := make([]Assertion, len(assertions))
+	for i, assertion := range assertions {
+		assertion.Selector = loadVariable(assertion.Selector, variables)
+		if value, ok := assertion.Value.(string); ok {
+			assertion.Value = loadVariable(value, variables)
+		}
+		loaded[i] = assertion
+	}
+	return loaded
+}
+
+// Checks the assertions of an endpoint on the response body.
+// Returns the failed assertions and the JSON pointers of the values not fulfilling them
+func checkAssertions(assertions []Assertion, body []byte) ([]string, []string) {
+	if len(assertions) == 0 {
+		return nil, nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return []string{"Response body is not JSON, assertions can not be checked"}, nil
+	}
+
+	var failures, pointers []string
+	for _, assertion := range assertions {
+		name := assertion.Selector + " " + assertion.Operator
+		if assertion.Value != nil {
+			value_json, _ := json.Marshal(assertion.Value)
+			name += " " + string(value_json)
+		}
+
+		check, ok := ASSERT_OPERATORS[assertion.Operator]
+		if !ok {
+			failures = append(failures, name+": unknown operator")
+			continue
+		}
+		selection, err := selectValues(document, assertion.Selector)
+		if err != nil {
+			failures = append(failures, name+": "+err.Error())
+			continue
+		}
+		// Values of the config are compared as JSON, e.g. integers of TOML equal numbers of the response
+		var value interface{}
+		value_json, _ := json.Marshal(assertion.Value)
+		json.Unmarshal(value_json, &value)
+
+		mismatches, err := check(selection, value)
+		if err != nil {
+			failures = append(failures, name+": "+err.Error())
+			continue
+		}
+		// Failures of the whole selection are keyed by the empty pointer, like the root
+		if message, ok := mismatches[""]; ok {
+			failures = append(failures, name+": "+message)
+		}
+		for _, selected := range selection {
+			if message, ok := mismatches[selected.Pointer]; ok && selected.Pointer != "" {
+				failures = append(failures, name+": "+message)
+				pointers = append(pointers, selected.Pointer)
+			}
+		}
+	}
+	return failures, pointers
+}
+
+// Selects the values of the document by a JSON pointer or a JSONPath.
+// JSONPath supports the root "$", children (".name", "['name']", "[0]"), wildcards (".*", "[*]")
+// and the recursive descent ("..name").
+func selectValues(document interface{}, selector string) ([]Selected, error) {
+	if selector == "" || strings.HasPrefix(selector, "/") {
+		value, ok := resolvePointer(document, selector)
+		if !ok {
+			return nil, nil
+		}
+		return []Selected{{Pointer: selector, Value: value}}, nil
+	}
+	if !strings.HasPrefix(selector, "$") {
+		return nil, fmt.Errorf("selector is neither a JSON pointer nor a JSONPath")
+	}
+
+	selection := []Selected{{Pointer: "", Value: document}}
+	rest := selector[1:]
+	for rest != "" {
+		var next []Selected
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			name, length := pathName(rest[2:])
+			if length == 0 {
+				return nil, fmt.Errorf("invalid JSONPath at '%s'", rest)
+			}
+			rest = rest[2+length:]
+			for _, selected := range selection {
+				next = append(next, descendants(selected, name)...)
+			}
+		case strings.HasPrefix(rest, "."):
+			name, length := pathName(rest[1:])
+			if length == 0 {
+				return nil, fmt.Errorf("invalid JSONPath at '%s'", rest)
+			}
+			rest = rest[1+length:]
+			for _, selected := range selection {
+				next = append(next, children(selected, name)...)
+			}
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath at '%s'", rest)
+			}
+			name := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0] {
+				name = name[1 : len(name)-1]
+			} else if _, err := strconv.Atoi(name); err != nil && name != "*" {
+				return nil, fmt.Errorf("unsupported JSONPath expression '[%s]'", name)
+			}
+			for _, selected := range selection {
+				next = append(next, children(selected, name)...)
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath at '%s'", rest)
+		}
+		selection = next
+	}
+	return selection, nil
+}
+
+// Returns the name at the start of a JSONPath and its length
+func pathName(path string) (string, int) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	return path[:end], end
+}
+
+// Returns the children of a value with the given name, index or all children for "*"
+func children(selected Selected, name string) []Selected {
+	var result []Selected
+	switch value := selected.Value.(type) {
+	case map[string]interface{}:
+		if name == "*" {
+			for _, key := range sortedKeys(value) {
+				result = append(result, Selected{selected.Pointer + jsonPointer([]string{key}), value[key]})
+			}
+		} else if child, ok := value[name]; ok {
+			result = append(result, Selected{selected.Pointer + jsonPointer([]string{name}), child})
+		}
+	case []interface{}:
+		if name == "*" {
+			for i, child := range value {
+				result = append(result, Selected{selected.Pointer + "/" + strconv.Itoa(i), child})
+			}
+		} else if i, err := strconv.Atoi(name); err == nil {
+			if i < 0 {
+				i += len(value)
+			}
+			if i >= 0 && i < len(value) {
+				result = append(result, Selected{selected.Pointer + "/" + strconv.Itoa(i), value[i]})
+			}
+		}
+	}
+	return result
+}
+
+// Returns the children with the given name of a value and of all values nested in it
+func descendants(selected Selected, name string) []Selected {
+	result := children(selected, name)
+	for _, child := range children(selected, "*") {
+		result = append(result, descendants(child, name)...)
+	}
+	return result
+}
+
+// Resolves a JSON pointer in the document
+func resolvePointer(document interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return document, true
+	}
+	value := document
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(token, "~1", "/", -1)
+		token = strings.Replace(token, "~0", "~", -1)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Returns the keys of the object in alphabetical order
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the items of the selection, the items of a single selected array are selected instead of the array
+func items(selection []Selected) []Selected {
+	if len(selection) == 1 {
+		if _, ok := selection[0].Value.([]interface{}); ok {
+			return children(selection[0], "*")
+		}
+	}
+	return selection
+}
+
+// All selected values are equal to the value
+func assertEquals(selection []Selected, value interface{}) (map[string]string, error) {
+	mismatches := make(map[string]string)
+	if len(selection) == 0 {
+		mismatches[""] = "no value selected"
+	}
+	for _, selected := range selection {
+		if !reflect.DeepEqual(selected.Value, value) {
+			value_json, _ := json.Marshal(selected.Value)
+			mismatches[selected.Pointer] = "value at " + pointerOrRoot(selected.Pointer) + " is " + string(value_json)
+		}
+	}
+	return mismatches, nil
+}
+
+// A selected value (or item of a selected array) equals the value, or a selected string contains the string
+func assertContains(selection []Selected, value interface{}) (map[string]string, error) {
+	for _, selected := range items(selection) {
+		if reflect.DeepEqual(selected.Value, value) {
+			return nil, nil
+		}
+		str, ok := selected.Value.(string)
+		substr, is_string := value.(string)
+		if ok && is_string && strings.Contains(str, substr) {
+			return nil, nil
+		}
+	}
+	return map[string]string{"": "not contained in the selected values"}, nil
+}
+
+// All selected values are strings matching the regular expression
+func assertMatches(selection []Selected, value interface{}) (map[string]string, error) {
+	pattern, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("value is not a regular expression")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("value is not a regular expression: %v", err)
+	}
+	mismatches := make(map[string]string)
+	if len(selection) == 0 {
+		mismatches[""] = "no value selected"
+	}
+	for _, selected := range selection {
+		if str, ok := selected.Value.(string); !ok || !re.MatchString(str) {
+			value_json, _ := json.Marshal(selected.Value)
+			mismatches[selected.Pointer] = "value at " + pointerOrRoot(selected.Pointer) + " is " + string(value_json)
+		}
+	}
+	return mismatches, nil
+}
+
+// At least the given number of values (or items of a selected array) are selected
+func assertCount(selection []Selected, value interface{}) (map[string]string, error) {
+	minimum, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("value is not a number")
+	}
+	if count := len(items(selection)); float64(count) < minimum {
+		return map[string]string{"": fmt.Sprintf("%d values selected", count)}, nil
+	}
+	return nil, nil
+}
+
+// All selected values are of the JSON type (string, number, integer, boolean, array, object or null)
+func assertType(selection []Selected, value interface{}) (map[string]string, error) {
+	json_type, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("value is not a JSON type")
+	}
+	mismatches := make(map[string]string)
+	if len(selection) == 0 {
+		mismatches[""] = "no value selected"
+	}
+	for _, selected := range selection {
+		if actual := jsonType(selected.Value); actual != json_type && !(json_type == "number" && actual == "integer") {
+			mismatches[selected.Pointer] = "value at " + pointerOrRoot(selected.Pointer) + " is of type " + actual
+		}
+	}
+	return mismatches, nil
+}
+
+// A value is selected, or no value is selected if the value is false
+func assertExists(selection []Selected, value interface{}) (map[string]string, error) {
+	exists := true
+	if value != nil {
+		var ok bool
+		if exists, ok = value.(bool); !ok {
+			return nil, fmt.Errorf("value is not a boolean")
+		}
+	}
+	if exists && len(selection) == 0 {
+		return map[string]string{"": "no value selected"}, nil
+	}
+	if !exists && len(selection) > 0 {
+		mismatches := make(map[string]string)
+		for _, selected := range selection {
+			mismatches[selected.Pointer] = "value exists at " + pointerOrRoot(selected.Pointer)
+		}
+		return mismatches, nil
+	}
+	return nil, nil
+}
+
+// Returns the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
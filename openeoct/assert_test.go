@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ASSERT_TEST_BODY = `{
+	"id": "openeo",
+	"api_version": "1.0.0",
+	"collections": [
+		{"id": "S2", "bands": [{"name": "B1"}, {"name": "B2"}]},
+		{"id": "L8", "bands": [{"name": "B1"}]}
+	],
+	"a/b": {"c~d": 1.5},
+	"empty": []
+}`
+
+func TestSelectValues(t *testing.T) {
+	var document interface{}
+	json.Unmarshal([]byte(ASSERT_TEST_BODY), &document)
+
+	tests := []struct {
+		selector string
+		pointers []string
+		err      string
+	}{
+		{"", []string{""}, ""},
+		{"/id", []string{"/id"}, ""},
+		{"/collections/1/id", []string{"/collections/1/id"}, ""},
+		{"/a~1b/c~0d", []string{"/a~1b/c~0d"}, ""},
+		{"/collections/2", nil, ""},
+		{"/missing", nil, ""},
+		{"$", []string{""}, ""},
+		{"$.id", []string{"/id"}, ""},
+		{"$['api_version']", []string{"/api_version"}, ""},
+		{"$.collections[0].id", []string{"/collections/0/id"}, ""},
+		{"$.collections[-1].id", []string{"/collections/1/id"}, ""},
+		{"$.collections[*].id", []string{"/collections/0/id", "/collections/1/id"}, ""},
+		{"$.collections.*.id", []string{"/collections/0/id", "/collections/1/id"}, ""},
+		{"$..name", []string{"/collections/0/bands/0/name", "/collections/0/bands/1/name", "/collections/1/bands/0/name"}, ""},
+		{"$.missing[*]", nil, ""},
+		{"id", nil, "neither a JSON pointer nor a JSONPath"},
+		{"$.collections[0", nil, "invalid JSONPath"},
+		{"$.collections[?(@.id)]", nil, "unsupported JSONPath expression"},
+		{"$.", nil, "invalid JSONPath"},
+	}
+	for _, test := range tests {
+		selection, err := selectValues(document, test.selector)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("selectValues(%s) = %v, expected error containing %q", test.selector, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectValues(%s) failed: %v", test.selector, err)
+			continue
+		}
+		var pointers []string
+		for _, selected := range selection {
+			pointers = append(pointers, selected.Pointer)
+		}
+		if !reflect.DeepEqual(pointers, test.pointers) {
+			t.Errorf("selectValues(%s) = %v, expected %v", test.selector, pointers, test.pointers)
+		}
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	tests := []struct {
+		assertion Assertion
+		failure   string
+		pointers  []string
+	}{
+		{Assertion{"/id", "equals", "openeo"}, "", nil},
+		{Assertion{"$.collections[*].id", "equals", "S2"}, "value at /collections/1/id is \"L8\"", []string{"/collections/1/id"}},
+		{Assertion{"/a~1b/c~0d", "equals", 1.5}, "", nil},
+		{Assertion{"/missing", "equals", "x"}, "no value selected", nil},
+		{Assertion{"$.collections[*].id", "contains", "L8"}, "", nil},
+		{Assertion{"/api_version", "contains", "1.0"}, "", nil},
+		{Assertion{"$.collections[*].id", "contains", "MODIS"}, "not contained in the selected values", nil},
+		{Assertion{"/api_version", "matches", `^1\.\d+\.\d+$`}, "", nil},
+		{Assertion{"$..name", "matches", "^B1$"}, "value at /collections/0/bands/1/name is \"B2\"", []string{"/collections/0/bands/1/name"}},
+		{Assertion{"/id", "matches", "("}, "value is not a regular expression", nil},
+		{Assertion{"/collections", "count", 2}, "", nil},
+		{Assertion{"$..name", "count", 3}, "", nil},
+		{Assertion{"/empty", "count", 1}, "0 values selected", nil},
+		{Assertion{"/id", "count", "one"}, "value is not a number", nil},
+		{Assertion{"/collections", "type", "array"}, "", nil},
+		{Assertion{"/a~1b/c~0d", "type", "number"}, "", nil},
+		{Assertion{"/a~1b/c~0d", "type", "integer"}, "value at /a~1b/c~0d is of type number", []string{"/a~1b/c~0d"}},
+		{Assertion{"", "type", "object"}, "", nil},
+		{Assertion{"", "type", "array"}, "value at / is of type object", nil},
+		{Assertion{"/id", "exists", nil}, "", nil},
+		{Assertion{"/missing", "exists", true}, "no value selected", nil},
+		{Assertion{"/missing", "exists", false}, "", nil},
+		{Assertion{"/id", "exists", false}, "value exists at /id", []string{"/id"}},
+		{Assertion{"/id", "exists", "yes"}, "value is not a boolean", nil},
+		{Assertion{"/id", "starts", "open"}, "unknown operator", nil},
+		{Assertion{"id", "exists", nil}, "neither a JSON pointer nor a JSONPath", nil},
+	}
+	for _, test := range tests {
+		failures, pointers := checkAssertions([]Assertion{test.assertion}, []byte(ASSERT_TEST_BODY))
+		if test.failure == "" && len(failures) > 0 {
+			t.Errorf("%v failed: %v", test.assertion, failures)
+		} else if test.failure != "" && (len(failures) != 1 || !strings.Contains(failures[0], test.failure)) {
+			t.Errorf("%v = %v, expected failure containing %q", test.assertion, failures, test.failure)
+		}
+		if !reflect.DeepEqual(pointers, test.pointers) {
+			t.Errorf("%v selected %v, expected %v", test.assertion, pointers, test.pointers)
+		}
+	}
+
+	failures, _ := checkAssertions([]Assertion{{"/id", "exists", nil}}, []byte("<html></html>"))
+	if len(failures) != 1 || !strings.Contains(failures[0], "not JSON") {
+		t.Errorf("assertions on HTML = %v, expected failure for body that is not JSON", failures)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3filter"
+)
+
+// Name of the report group containing the capabilities audit
+const AUDIT_GROUP = "Capabilities Audit"
+
+// Audits the endpoints advertised in the capabilities of the back end against the openEO API.
+// Every advertised path and method is looked up in the API definition and paths without parameters
+// are probed at the back end.
+// Returns a map of strings containing the states of the audit results, keyed by method and path
+func (ct *ComplianceTest) auditCapabilities() map[string](map[string]string) {
+
+	states := make(map[string](map[string]string))
+
+	router, errLoad := ct.loadRouter()
+
+	if errLoad != nil {
+		states["capabilities"] = map[string]string{
+			"state":   "Error",
+			"message": errLoad.toString(),
+			"url":     "/",
+			"type":    http.MethodGet,
+		}
+		return states
+	}
+
+	probed := make(map[string]*ErrorMessage)
+
+	for _, cap_ep := range ct.advertised.Endpoints {
+		for _, method := range cap_ep.Methods {
+			id := method + " " + cap_ep.Path
+			states[id] = map[string]string{
+				"state":   "Valid",
+				"message": "",
+				"url":     cap_ep.Path,
+				"type":    method,
+			}
+
+			err := auditPath(router, cap_ep.Path, method)
+			if err != nil {
+				states[id]["state"] = "Invalid"
+				states[id]["message"] = err.toString()
+				continue
+			}
+
+			// Templated paths can not be probed without knowing valid identifiers
+			if strings.Contains(cap_ep.Path, "{") {
+				continue
+			}
+
+			if _, ok := probed[cap_ep.Path]; !ok {
+				probed[cap_ep.Path] = ct.probePath(cap_ep.Path)
+			}
+			if err := probed[cap_ep.Path]; err != nil {
+				states[id]["state"] = "Missing"
+				states[id]["message"] = err.toString()
+			}
+		}
+	}
+
+	return states
+}
+
+// Looks up an advertised path and method in the API definition.
+// Returns an error message if the path or method is unknown, or if the path only matches
+// with different parameter names.
+func auditPath(router *openapi3filter.Router, cap_path string, method string) *ErrorMessage {
+
+	route, _, err := router.FindRoute(method, &url.URL{Path: cap_path})
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = method + "  " + cap_path
+		errormsg.msg = "Advertised path does not exist in the OpenAPI definition"
+		errormsg.output = string(err.Error())
+
+		// Distinguish unknown methods from unknown paths
+		if routeErr, ok := err.(*openapi3filter.RouteError); ok && routeErr.Route.Swagger != nil {
+			if pathItem := routeErr.Route.Swagger.Paths.Find(cap_path); pathItem != nil {
+				var methods []string
+				for spec_method := range pathItem.Operations() {
+					methods = append(methods, spec_method)
+				}
+				sort.Strings(methods)
+				errormsg.msg = "Advertised method does not exist for this path in the OpenAPI definition"
+				errormsg.output = "Allowed methods: " + strings.Join(methods, ", ")
+			}
+		}
+		return errormsg
+	}
+
+	if route.Path != cap_path {
+		errormsg := new(ErrorMessage)
+		errormsg.input = method + "  " + cap_path
+		errormsg.msg = "Advertised path differs from the OpenAPI definition in parameter names"
+		errormsg.output = "Expected path: " + route.Path
+		return errormsg
+	}
+
+	return nil
+}
+
+// Probes an advertised path at the back end with OPTIONS, falling back to HEAD if OPTIONS is not supported.
+// Returns an error message if the back end responds with 404 or can not be reached.
+func (ct *ComplianceTest) probePath(cap_path string) *ErrorMessage {
+
+	client := ct.newClient(30 * time.Second)
+	probe_url := build_url(ct.backend.url, cap_path)
+
+	var resp *http.Response
+	var err error
+	for _, method := range []string{http.MethodOptions, http.MethodHead} {
+		httpReq, _ := http.NewRequest(method, probe_url, nil)
+		resp, err = client.Do(httpReq)
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = probe_url
+		errormsg.msg = "Error probing advertised path at the back end"
+		errormsg.output = string(err.Error())
+		return errormsg
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		errormsg := new(ErrorMessage)
+		errormsg.input = resp.Request.Method + "  " + probe_url
+		errormsg.msg = "Advertised path not found at the back end, Response Code " + strconv.Itoa(resp.StatusCode)
+		errormsg.output = ""
+		return errormsg
+	}
+
+	return nil
+}
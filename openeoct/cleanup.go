@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Name of the report group containing the results of the cleanup
+const CLEANUP_GROUP = "Cleanup"
+
+// Paths of the resources created by POST requests, which return the identifier of the new resource
+// in the OpenEO-Identifier header (jobs, services and the UDPs of API 0.4)
+var CLEANUP_COLLECTIONS = []string{"/jobs", "/services", "/process_graphs"}
+
+// Prefixes of the paths of resources created by PUT requests (the UDPs of API 1.0 and files)
+var CLEANUP_PREFIXES = []string{"/process_graphs/", "/files/"}
+
+// Tracks the resources created and deleted by a successful request to the back end, if the automatic
+// cleanup is activated. Resources deleted by the configured endpoints are not deleted again.
+func (ct *ComplianceTest) trackResource(method string, ep_url string, header http.Header) {
+	if !ct.autocleanup {
+		return
+	}
+	ep_path := path.Clean("/" + strings.SplitN(ep_url, "?", 2)[0])
+
+	switch method {
+	case http.MethodPost:
+		id := header.Get("OpenEO-Identifier")
+		if id == "" {
+			return
+		}
+		for _, collection := range CLEANUP_COLLECTIONS {
+			if ep_path == collection {
+				ct.addResource(path.Join(collection, id))
+			}
+		}
+	case http.MethodPut:
+		for _, prefix := range CLEANUP_PREFIXES {
+			if strings.HasPrefix(ep_path, prefix) {
+				ct.addResource(ep_path)
+			}
+		}
+	case http.MethodDelete:
+		for i, resource := range ct.resources {
+			if resource == ep_path {
+				ct.resources = append(ct.resources[:i], ct.resources[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (ct *ComplianceTest) addResource(resource string) {
+	for _, tracked := range ct.resources {
+		if tracked == resource {
+			return
+		}
+	}
+	ct.resources = append(ct.resources, resource)
+}
+
+// Runs the configured cleanup endpoints and deletes the tracked resources in reverse order of their creation.
+// Returns a map of strings containing the states of the requests, keyed by endpoint id or method and path
+func (ct *ComplianceTest) runCleanup() map[string](map[string]string) {
+
+	states := make(map[string](map[string]string))
+
+	configured := make([]Endpoint, len(ct.cleanup))
+	copy(configured, ct.cleanup)
+	sort.Sort(ByOrder(configured))
+	for _, endpoint := range configured {
+		endpoint.loadVariablesToEndpoint(*ct)
+		endpoint.Group = CLEANUP_GROUP
+		if endpoint.Request_type == "" {
+			endpoint.Request_type = http.MethodDelete
+		}
+		ct.addCleanupState(states, endpoint)
+	}
+
+	// Resources deleted by the configured cleanup are removed from the tracked ones while deleting
+	for len(ct.resources) > 0 {
+		resource := ct.resources[len(ct.resources)-1]
+		ct.resources = ct.resources[:len(ct.resources)-1]
+		endpoint := Endpoint{
+			Id:           http.MethodDelete + " " + resource,
+			Url:          resource,
+			Request_type: http.MethodDelete,
+			Group:        CLEANUP_GROUP}
+		ct.addCleanupState(states, endpoint)
+	}
+
+	return states
+}
+
+func (ct *ComplianceTest) addCleanupState(states map[string](map[string]string), endpoint Endpoint) {
+	state, errormsg := ct.sendCleanupRequest(endpoint)
+	states[endpoint.Id] = map[string]string{
+		"state":   state,
+		"message": "",
+		"url":     endpoint.Url,
+		"type":    endpoint.Request_type,
+	}
+	if errormsg != nil {
+		states[endpoint.Id]["message"] = errormsg.toString()
+	}
+	ct.reportProgress(endpoint, states[endpoint.Id])
+}
+
+// Checks that none of the cleanup requests failed
+func cleanupSucceeded(states map[string](map[string]string)) bool {
+	for _, state := range states {
+		if state["state"] == "Error" {
+			return false
+		}
+	}
+	return true
+}
+
+// Sends the request of a cleanup endpoint. Resources that do not exist (anymore) are not an error,
+// as they may have been deleted by the back end or were never created.
+// Returns the resulting state and an error message if the request failed.
+func (ct *ComplianceTest) sendCleanupRequest(endpoint Endpoint) (string, *ErrorMessage) {
+
+	if GetStringInBetween(endpoint.Url, "{", "}") != "" {
+		errormsg := new(ErrorMessage)
+		errormsg.input = endpoint.Request_type + "  " + endpoint.Url
+		errormsg.msg = "Cleanup skipped, variable not set"
+		errormsg.output = ""
+		return "NotSupported", errormsg
+	}
+
+	httpReq, errReq := ct.buildRequest(endpoint, ct.token, true)
+	if errReq != nil {
+		return "Error", errReq
+	}
+
+	client := ct.newClient(30 * time.Second)
+	if endpoint.Timeout != 0 {
+		client.Timeout = time.Duration(endpoint.Timeout) * time.Second
+	}
+
+	resp, err := client.Do(httpReq)
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = httpReq.Method + "  " + endpoint.Url
+		errormsg.msg = "Error sending request to back end"
+		errormsg.output = string(err.Error())
+		return "Error", errormsg
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		errormsg := new(ErrorMessage)
+		errormsg.input = httpReq.Method + "  " + endpoint.Url
+		errormsg.msg = "Resource not found, nothing to clean up"
+		errormsg.output = string(body)
+		return "Valid", errormsg
+	} else if resp.StatusCode >= 400 {
+		errormsg := new(ErrorMessage)
+		errormsg.input = httpReq.Method + "  " + endpoint.Url
+		errormsg.msg = "Response Code " + strconv.Itoa(resp.StatusCode)
+		errormsg.output = string(body)
+		return "Error", errormsg
+	}
+
+	ct.trackResource(httpReq.Method, endpoint.Url, resp.Header)
+	return "Valid", nil
+}
+
+// Interrupts the run on SIGINT or SIGTERM: the request in progress is canceled and the remaining
+// endpoints are skipped, but the cleanup and the report still run. A second signal exits immediately.
+func (ct *ComplianceTest) interruptOnSignal() {
+	ct.interrupt = notifyInterrupt()
+}
+
+// Returns a context, which is canceled on SIGINT or SIGTERM. A second signal exits immediately.
+func notifyInterrupt() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stop := make(chan os.Signal, 2)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Println("Interrupted, cleaning up. Interrupt again to exit without cleanup")
+		cancel()
+		<-stop
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// Checks if the run was interrupted
+func (ct *ComplianceTest) interrupted() bool {
+	return ct.interrupt != nil && ct.interrupt.Err() != nil
+}
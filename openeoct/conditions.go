@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Documents of the back end that can be tested in when expressions, by their names
+var CONDITION_DOCUMENTS = map[string]string{
+	"capabilities":   "/",
+	"service_types":  "/service_types",
+	"output_formats": "/output_formats",
+	"file_formats":   "/file_formats",
+	"udf_runtimes":   "/udf_runtimes",
+}
+
+// Checks the depends_on and when conditions of an endpoint against the states of the endpoints
+// validated before. Returns the state and message of the skipped endpoint, or empty strings if it is validated.
+func (ct *ComplianceTest) checkConditions(endpoint Endpoint, states map[string](map[string]string)) (string, string) {
+	for _, id := range endpoint.Depends_on {
+		state, ok := states[id]
+		if !ok {
+			if !ct.hasEndpoint(id) {
+				return "Error", "Endpoint depends on unknown endpoint '" + id + "'"
+			}
+			return "NotSupported", "Endpoint skipped, depends on '" + id + "', which was not validated before"
+		}
+		if !isPassing(state["state"]) {
+			return "NotSupported", "Endpoint skipped, depends on '" + id + "', which is " + state["state"]
+		}
+	}
+
+	if endpoint.When != "" {
+		ok, err := ct.evaluateCondition(endpoint.When)
+		if err != nil {
+			return "Error", "Invalid when expression '" + endpoint.When + "': " + err.Error()
+		}
+		if !ok {
+			return "NotSupported", "Endpoint skipped, condition '" + endpoint.When + "' not met"
+		}
+	}
+	return "", ""
+}
+
+// Checks if an endpoint with the id is configured
+func (ct *ComplianceTest) hasEndpoint(id string) bool {
+	for _, endpoints := range ct.endpoints {
+		for _, endpoint := range endpoints {
+			if endpoint.Id == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the names of the groups in the order of validation: alphabetical, but groups containing
+// endpoints other groups depend on are validated before them
+func (ct *ComplianceTest) groupOrder() []string {
+	group_of := make(map[string]string)
+	var remaining []string
+	for group, endpoints := range ct.endpoints {
+		remaining = append(remaining, group)
+		for _, endpoint := range endpoints {
+			group_of[endpoint.Id] = group
+		}
+	}
+	sort.Strings(remaining)
+
+	var order []string
+	done := make(map[string]bool)
+	for len(remaining) > 0 {
+		// Cyclic dependencies are resolved by taking the first remaining group
+		next := 0
+		for i, group := range remaining {
+			ready := true
+			for _, endpoint := range ct.endpoints[group] {
+				for _, id := range endpoint.Depends_on {
+					if dependency, ok := group_of[id]; ok && dependency != group && !done[dependency] {
+						ready = false
+					}
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		done[remaining[next]] = true
+		order = append(order, remaining[next])
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return order
+}
+
+// Evaluates a when expression. The expression combines tests with "!", "&&", "||" and parentheses.
+// A test is a variable ("variables.job_id", set and not empty) or a value in a document of the back end
+// ("capabilities.billing", "service_types.WMTS"), which exists and is neither null nor false.
+func (ct *ComplianceTest) evaluateCondition(expression string) (bool, error) {
+	parser := &conditionParser{ct: ct, tokens: tokenizeCondition(expression)}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.position < len(parser.tokens) {
+		return false, fmt.Errorf("unexpected '%s'", parser.tokens[parser.position])
+	}
+	return result, nil
+}
+
+// Splits a when expression into operators, parentheses and tests
+func tokenizeCondition(expression string) []string {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		switch {
+		case expression[i] == ' ' || expression[i] == '\t':
+			i++
+		case strings.HasPrefix(expression[i:], "&&") || strings.HasPrefix(expression[i:], "||"):
+			tokens = append(tokens, expression[i:i+2])
+			i += 2
+		case strings.ContainsRune("!()", rune(expression[i])):
+			tokens = append(tokens, expression[i:i+1])
+			i++
+		default:
+			end := i
+			for end < len(expression) && !strings.ContainsRune(" \t!()&|", rune(expression[end])) {
+				end++
+			}
+			if end == i {
+				// A single "&" or "|"
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
+
+// conditionParser "class", a recursive descent parser evaluating a when expression
+type conditionParser struct {
+	ct       *ComplianceTest
+	tokens   []string
+	position int
+}
+
+func (parser *conditionParser) peek() string {
+	if parser.position < len(parser.tokens) {
+		return parser.tokens[parser.position]
+	}
+	return ""
+}
+
+func (parser *conditionParser) parseOr() (bool, error) {
+	result, err := parser.parseAnd()
+	for err == nil && parser.peek() == "||" {
+		parser.position++
+		var right bool
+		right, err = parser.parseAnd()
+		result = result || right
+	}
+	return result, err
+}
+
+func (parser *conditionParser) parseAnd() (bool, error) {
+	result, err := parser.parseUnary()
+	for err == nil && parser.peek() == "&&" {
+		parser.position++
+		var right bool
+		right, err = parser.parseUnary()
+		result = result && right
+	}
+	return result, err
+}
+
+func (parser *conditionParser) parseUnary() (bool, error) {
+	token := parser.peek()
+	parser.position++
+	switch token {
+	case "":
+		return false, fmt.Errorf("unexpected end of expression")
+	case "!":
+		result, err := parser.parseUnary()
+		return !result, err
+	case "(":
+		result, err := parser.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if parser.peek() != ")" {
+			return false, fmt.Errorf("missing ')'")
+		}
+		parser.position++
+		return result, nil
+	case ")", "&&", "||", "&", "|":
+		return false, fmt.Errorf("unexpected '%s'", token)
+	}
+	return parser.ct.testCondition(token)
+}
+
+// Evaluates a single test of a when expression
+func (ct *ComplianceTest) testCondition(test string) (bool, error) {
+	path := strings.Split(test, ".")
+	if path[0] == "variables" {
+		if len(path) != 2 {
+			return false, fmt.Errorf("expected 'variables.NAME' instead of '%s'", test)
+		}
+		return ct.variables[path[1]] != "", nil
+	}
+	if _, ok := CONDITION_DOCUMENTS[path[0]]; !ok {
+		return false, fmt.Errorf("unknown name '%s'", path[0])
+	}
+
+	value := ct.loadDocument(path[0])
+	for _, element := range path[1:] {
+		if value = childValue(value, element); value == nil {
+			break
+		}
+	}
+	return value != nil && value != false, nil
+}
+
+// Returns the child of a JSON value: the property of an object, or the item of an array
+// at the index, equal to the string or with the string as "id" or "name"
+func childValue(value interface{}, name string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v[name]
+	case []interface{}:
+		if i, err := strconv.Atoi(name); err == nil {
+			if i >= 0 && i < len(v) {
+				return v[i]
+			}
+			return nil
+		}
+		for _, item := range v {
+			if item == name {
+				return item
+			}
+			if object, ok := item.(map[string]interface{}); ok && (object["id"] == name || object["name"] == name) {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+// Requests a document of the back end once per compliance test instance.
+// Returns nil if the back end does not respond with a JSON document.
+func (ct *ComplianceTest) loadDocument(name string) interface{} {
+	if document, ok := ct.documents[name]; ok {
+		return document
+	}
+	if ct.documents == nil {
+		ct.documents = make(map[string]interface{})
+	}
+	ct.documents[name] = nil
+
+	client := ct.newClient(30 * time.Second)
+	httpReq, _ := http.NewRequest(http.MethodGet, build_url(ct.backend.url, CONDITION_DOCUMENTS[name]), nil)
+	setBearer(httpReq, ct.token)
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var document interface{}
+	if json.Unmarshal(body, &document) == nil {
+		ct.documents[name] = document
+	}
+	return ct.documents[name]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeCondition(t *testing.T) {
+	tests := []struct {
+		expression string
+		tokens     []string
+	}{
+		{"variables.job_id", []string{"variables.job_id"}},
+		{"!a&&(b||c)", []string{"!", "a", "&&", "(", "b", "||", "c", ")"}},
+		{"  a &&\tb  ", []string{"a", "&&", "b"}},
+		{"a & b", []string{"a", "&", "b"}},
+		{"a | b", []string{"a", "|", "b"}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if tokens := tokenizeCondition(test.expression); !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("tokenizeCondition(%q) = %q, expected %q", test.expression, tokens, test.tokens)
+		}
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	ct := new(ComplianceTest)
+	ct.variables = map[string]string{"job_id": "j-1", "empty": ""}
+	// The documents are loaded already, so that no request is sent to the back end
+	ct.documents = make(map[string]interface{})
+	for name, document := range map[string]string{
+		"capabilities":   `{"billing": {"currency": "EUR"}, "production": false, "endpoints": [{"path": "/jobs"}]}`,
+		"service_types":  `{"WMTS": {}}`,
+		"output_formats": `{"GTiff": {"gis_data_types": ["raster"]}}`,
+		"file_formats":   `null`,
+		"udf_runtimes":   `[{"name": "Python"}, "R"]`,
+	} {
+		var value interface{}
+		json.Unmarshal([]byte(document), &value)
+		ct.documents[name] = value
+	}
+
+	tests := []struct {
+		expression string
+		result     bool
+		err        string
+	}{
+		{"variables.job_id", true, ""},
+		{"variables.empty", false, ""},
+		{"variables.missing", false, ""},
+		{"capabilities.billing", true, ""},
+		{"capabilities.billing.currency", true, ""},
+		{"capabilities.production", false, ""},
+		{"capabilities.endpoints.0.path", true, ""},
+		{"capabilities.endpoints.1", false, ""},
+		{"service_types.WMTS", true, ""},
+		{"service_types.WMS", false, ""},
+		{"output_formats.GTiff.gis_data_types.raster", true, ""},
+		{"file_formats", false, ""},
+		{"udf_runtimes.Python", true, ""},
+		{"udf_runtimes.R", true, ""},
+		{"udf_runtimes.JavaScript", false, ""},
+		{"!variables.job_id", false, ""},
+		{"!!variables.job_id", true, ""},
+		// && binds stronger than ||
+		{"variables.job_id || variables.empty && variables.missing", true, ""},
+		{"(variables.job_id || variables.empty) && variables.missing", false, ""},
+		{"variables.empty && variables.missing || variables.job_id", true, ""},
+		{"variables.empty && (variables.missing || variables.job_id)", false, ""},
+		// ! binds stronger than && and ||
+		{"!variables.empty && variables.job_id", true, ""},
+		{"!(variables.empty || variables.job_id)", false, ""},
+		{"!variables.empty || variables.missing", true, ""},
+		{"", false, "unexpected end of expression"},
+		{"variables.job_id &&", false, "unexpected end of expression"},
+		{"(variables.job_id", false, "missing ')'"},
+		{"variables.job_id)", false, "unexpected ')'"},
+		{"variables.job_id variables.empty", false, "unexpected 'variables.empty'"},
+		{"variables.job_id & variables.empty", false, "unexpected '&'"},
+		{"|| variables.job_id", false, "unexpected '||'"},
+		{"variables", false, "expected 'variables.NAME'"},
+		{"variables.a.b", false, "expected 'variables.NAME'"},
+		{"collections.S2", false, "unknown name 'collections'"},
+	}
+	for _, test := range tests {
+		result, err := ct.evaluateCondition(test.expression)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("evaluateCondition(%q) = %v, expected error containing %q", test.expression, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("evaluateCondition(%q) failed: %v", test.expression, err)
+		} else if result != test.result {
+			t.Errorf("evaluateCondition(%q) = %v, expected %v", test.expression, result, test.result)
+		}
+	}
+}
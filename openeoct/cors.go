@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the report group containing the CORS checks
+const CORS_GROUP = "CORS"
+
+// Origin sent with the CORS requests
+const CORS_ORIGIN = "http://example.com"
+
+// Headers that have to be exposed to the client according to the openEO API
+var CORS_EXPOSE_HEADERS = []string{"Location", "OpenEO-Identifier", "OpenEO-Costs"}
+
+// Headers that have to be allowed in requests according to the openEO API
+var CORS_ALLOW_HEADERS = []string{"Authorization", "Content-Type"}
+
+// Checks the Cross-Origin Resource Sharing (CORS) support of the back end on all configured endpoints.
+// Every path is requested with and without Origin header and every configured method is preflighted.
+// Returns a map of strings containing the states of the CORS checks, keyed by check, method and path
+func (ct *ComplianceTest) validateCors() map[string](map[string]string) {
+
+	states := make(map[string](map[string]string))
+
+	// Collect the configured methods per path
+	paths := make(map[string]map[string]bool)
+	for _, endpoints := range ct.endpoints {
+		for _, endpoint := range endpoints {
+			endpoint.loadVariablesToEndpoint(*ct)
+			if paths[endpoint.Url] == nil {
+				paths[endpoint.Url] = make(map[string]bool)
+			}
+			paths[endpoint.Url][endpoint.Request_type] = true
+		}
+	}
+
+	for ep_path, methods := range paths {
+		var method_list []string
+		for method := range methods {
+			method_list = append(method_list, method)
+		}
+		sort.Strings(method_list)
+
+		for _, method := range method_list {
+			id := "preflight " + method + " " + ep_path
+			states[id] = map[string]string{
+				"state":   "Valid",
+				"message": "",
+				"url":     ep_path,
+				"type":    http.MethodOptions,
+			}
+			if err := ct.checkCorsPreflight(ep_path, method); err != nil {
+				states[id]["state"] = "Invalid"
+				states[id]["message"] = err.toString()
+			}
+		}
+
+		// Only safe requests are sent as actual requests, to avoid changing data at the back end
+		if methods[http.MethodGet] {
+			id := "origin GET " + ep_path
+			states[id] = map[string]string{
+				"state":   "Valid",
+				"message": "",
+				"url":     ep_path,
+				"type":    http.MethodGet,
+			}
+			if err := ct.checkCorsRequest(ep_path); err != nil {
+				states[id]["state"] = "Invalid"
+				states[id]["message"] = err.toString()
+			}
+		}
+	}
+
+	return states
+}
+
+// Sends a preflight request for the given path and method and checks the CORS headers of the response.
+func (ct *ComplianceTest) checkCorsPreflight(ep_path string, method string) *ErrorMessage {
+
+	client := ct.newClient(30 * time.Second)
+
+	httpReq, _ := http.NewRequest(http.MethodOptions, ct.corsUrl(ep_path), nil)
+	httpReq.Header.Set("Origin", CORS_ORIGIN)
+	httpReq.Header.Set("Access-Control-Request-Method", method)
+	httpReq.Header.Set("Access-Control-Request-Headers", strings.Join(CORS_ALLOW_HEADERS, ", "))
+
+	resp, err := client.Do(httpReq)
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = http.MethodOptions + "  " + ep_path
+		errormsg.msg = "Error sending preflight request to back end"
+		errormsg.output = string(err.Error())
+		return errormsg
+	}
+	resp.Body.Close()
+
+	var problems []string
+
+	if resp.StatusCode != http.StatusNoContent {
+		problems = append(problems, "Response Code "+strconv.Itoa(resp.StatusCode)+" instead of 204")
+	}
+	problems = append(problems, checkCorsOrigin(resp.Header)...)
+
+	if !headerListContains(resp.Header.Get("Access-Control-Allow-Methods"), method) {
+		problems = append(problems, "Access-Control-Allow-Methods does not contain "+method)
+	}
+	for _, header := range CORS_ALLOW_HEADERS {
+		if !headerListContains(resp.Header.Get("Access-Control-Allow-Headers"), header) {
+			problems = append(problems, "Access-Control-Allow-Headers does not contain "+header)
+		}
+	}
+	problems = append(problems, checkCorsExposeHeaders(resp.Header)...)
+
+	return corsError(http.MethodOptions, ep_path, "Preflight request not CORS compliant", problems)
+}
+
+// Sends a GET request for the given path with and without Origin header and checks the CORS headers
+// of the response.
+func (ct *ComplianceTest) checkCorsRequest(ep_path string) *ErrorMessage {
+
+	client := ct.newClient(30 * time.Second)
+
+	var status [2]int
+	var problems []string
+
+	for i, origin := range []string{"", CORS_ORIGIN} {
+		httpReq, _ := http.NewRequest(http.MethodGet, ct.corsUrl(ep_path), nil)
+		if origin != "" {
+			httpReq.Header.Set("Origin", origin)
+		}
+		setBearer(httpReq, ct.token)
+
+		resp, err := client.Do(httpReq)
+
+		if err != nil {
+			errormsg := new(ErrorMessage)
+			errormsg.input = http.MethodGet + "  " + ep_path
+			errormsg.msg = "Error sending request to back end"
+			errormsg.output = string(err.Error())
+			return errormsg
+		}
+		resp.Body.Close()
+		status[i] = resp.StatusCode
+
+		if origin != "" {
+			problems = append(problems, checkCorsOrigin(resp.Header)...)
+			problems = append(problems, checkCorsExposeHeaders(resp.Header)...)
+		}
+	}
+
+	if status[0] != status[1] {
+		problems = append(problems, "Response Code "+strconv.Itoa(status[1])+" with Origin header differs from "+strconv.Itoa(status[0])+" without")
+	}
+
+	return corsError(http.MethodGet, ep_path, "Request with Origin header not CORS compliant", problems)
+}
+
+func (ct *ComplianceTest) corsUrl(ep_path string) string {
+	if strings.Contains(ep_path, ".well-known") {
+		return build_url(ct.backend.baseurl, ep_path)
+	}
+	return build_url(ct.backend.url, ep_path)
+}
+
+func checkCorsOrigin(header http.Header) []string {
+	if allow_origin := header.Get("Access-Control-Allow-Origin"); allow_origin != CORS_ORIGIN {
+		return []string{"Access-Control-Allow-Origin is '" + allow_origin + "' instead of the request origin " + CORS_ORIGIN}
+	}
+	return nil
+}
+
+func checkCorsExposeHeaders(header http.Header) []string {
+	var problems []string
+	for _, expose := range CORS_EXPOSE_HEADERS {
+		if !headerListContains(header.Get("Access-Control-Expose-Headers"), expose) {
+			problems = append(problems, "Access-Control-Expose-Headers does not contain "+expose)
+		}
+	}
+	return problems
+}
+
+func corsError(method string, ep_path string, msg string, problems []string) *ErrorMessage {
+	if len(problems) == 0 {
+		return nil
+	}
+	errormsg := new(ErrorMessage)
+	errormsg.input = method + "  " + ep_path
+	errormsg.msg = msg
+	errormsg.output = strings.Join(problems, ", ")
+	return errormsg
+}
+
+// Checks case insensitive if a comma separated header value contains the given item
+func headerListContains(list string, item string) bool {
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, item) {
+			return true
+		}
+	}
+	return false
+}
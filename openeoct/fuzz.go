@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+)
+
+// Name of the report group containing the fuzzing requests
+const FUZZ_GROUP = "Fuzzing"
+
+// Default limits of the fuzzing, if not set in the config
+const (
+	FUZZ_REQUESTS = 30
+	FUZZ_DURATION = 60
+)
+
+// Kinds of mutations applied to the valid request bodies
+const (
+	FUZZ_MISSING_PROPERTY = "missing-property"
+	FUZZ_WRONG_TYPE       = "wrong-type"
+	FUZZ_BOUNDARY_NUMBER  = "boundary-number"
+	FUZZ_HUGE_STRING      = "huge-string"
+	FUZZ_INVALID_NODE     = "invalid-from-node"
+)
+
+var FUZZ_KINDS = []string{FUZZ_MISSING_PROPERTY, FUZZ_WRONG_TYPE, FUZZ_BOUNDARY_NUMBER, FUZZ_HUGE_STRING, FUZZ_INVALID_NODE}
+
+// Operations receiving process graphs, which are fuzzed if they exist in the openapi definition
+var FUZZ_PATHS = []string{"/result", "/jobs", "/process_graphs"}
+
+// Numbers at and beyond the limits of the usual number types
+var FUZZ_NUMBERS = []float64{-1, 0, 0.5, -2147483649, 9223372036854775808, 1.7976931348623157e308, -1.7976931348623157e308}
+
+// Values of all JSON types, one of another type replaces a value of the body
+var FUZZ_VALUES = []interface{}{"openeoct", 42.0, true, []interface{}{}, map[string]interface{}{}, nil}
+
+// Node id referenced by the invalid from_node mutation, not expected to exist in any process graph
+const FUZZ_NODE = "openeoct-invalid-node"
+
+// Length of the huge strings in bytes
+const FUZZ_STRING_LENGTH = 1 << 20
+
+var fuzzString = strings.Repeat("openeoct fuzz ", FUZZ_STRING_LENGTH/len("openeoct fuzz "))
+
+// FuzzTarget "class", an operation whose request body is fuzzed
+type FuzzTarget struct {
+	Path   string
+	Schema *openapi3.Schema
+	// Valid bodies of the configured endpoints of the operation
+	Bodies []interface{}
+}
+
+// Sends mutated, invalid bodies to the operations receiving process graphs and checks that the back end
+// answers every request with an openEO error. The number of requests and the duration are limited by the config.
+// Returns a map of strings containing the states of the requests, keyed by number, operation and mutation
+func (ct *ComplianceTest) validateFuzzing() map[string](map[string]string) {
+
+	states := make(map[string](map[string]string))
+
+	_, errLoad := ct.loadRouter()
+
+	if errLoad != nil {
+		states["fuzzing"] = map[string]string{
+			"state":   "Error",
+			"message": errLoad.toString(),
+			"url":     "",
+			"type":    "",
+		}
+		return states
+	}
+
+	var targets []*FuzzTarget
+	for _, spec_path := range FUZZ_PATHS {
+		id := http.MethodPost + " " + spec_path
+		path_item := ct.swagger.Paths[spec_path]
+		if path_item == nil || path_item.Post == nil || path_item.Post.RequestBody == nil {
+			continue
+		}
+		media := path_item.Post.RequestBody.Value.Content.Get("application/json")
+		if media == nil || media.Schema == nil {
+			continue
+		}
+
+		if !ct.checkCapability(Endpoint{Url: spec_path, Request_type: http.MethodPost}) {
+			states[id] = map[string]string{
+				"state":   "NotSupported",
+				"message": "Fuzzing skipped, endpoint not listed in backend capabilities",
+				"url":     spec_path,
+				"type":    http.MethodPost,
+			}
+			continue
+		}
+
+		if requiresAuthentication(ct.swagger, path_item.Post) && ct.token == "" {
+			states[id] = map[string]string{
+				"state":   "NotSupported",
+				"message": "Fuzzing skipped, requires the credentials of a user",
+				"url":     spec_path,
+				"type":    http.MethodPost,
+			}
+			continue
+		}
+
+		targets = append(targets, &FuzzTarget{
+			Path:   spec_path,
+			Schema: media.Schema.Value,
+			Bodies: ct.configuredBodies(spec_path),
+		})
+	}
+
+	if len(targets) == 0 {
+		return states
+	}
+
+	requests := ct.fuzzrequests
+	if requests <= 0 {
+		requests = FUZZ_REQUESTS
+	}
+	duration := time.Duration(ct.fuzzduration) * time.Second
+	if duration <= 0 {
+		duration = FUZZ_DURATION * time.Second
+	}
+	deadline := time.Now().Add(duration)
+
+	random := rand.New(rand.NewSource(ct.fuzzseed))
+	generator := openapi3.NewSampleGenerator(ct.fuzzseed)
+	generator.UseExamples = true
+	generator.ValidationOptions = []openapi3.SchemaValidationOption{openapi3.VisitAsRequest()}
+
+	for number := 0; number < requests && time.Now().Before(deadline); number++ {
+		target := targets[number%len(targets)]
+		first_kind := (number / len(targets)) % len(FUZZ_KINDS)
+
+		var body interface{}
+		if len(target.Bodies) > 0 && (random.Intn(2) == 0) {
+			body = target.Bodies[random.Intn(len(target.Bodies))]
+		} else {
+			var err error
+			if body, err = generator.Generate(target.Schema); err != nil && len(target.Bodies) == 0 {
+				states[http.MethodPost+" "+target.Path] = map[string]string{
+					"state":   "Error",
+					"message": "Fuzzing skipped, no valid body configured or generated: " + err.Error(),
+					"url":     target.Path,
+					"type":    http.MethodPost,
+				}
+				continue
+			} else if err != nil {
+				body = target.Bodies[0]
+			}
+		}
+
+		// Kinds not applicable to the body are replaced by the next one
+		for i := range FUZZ_KINDS {
+			kind := FUZZ_KINDS[(first_kind+i)%len(FUZZ_KINDS)]
+			mutated, description, ok := fuzzBody(random, target.Schema, body, kind)
+			if !ok {
+				continue
+			}
+
+			id := fmt.Sprintf("fuzz %03d %s %s %s", number+1, http.MethodPost, target.Path, kind)
+			states[id] = map[string]string{
+				"state":   "Valid",
+				"message": "",
+				"url":     target.Path,
+				"type":    http.MethodPost,
+			}
+			state, err := ct.sendFuzzRequest(target.Path, mutated, description)
+			states[id]["state"] = state
+			if err != nil {
+				states[id]["message"] = err.toString()
+			}
+			ct.reportProgress(Endpoint{Id: id, Url: target.Path, Request_type: http.MethodPost, Group: FUZZ_GROUP}, states[id])
+			break
+		}
+	}
+
+	return states
+}
+
+// Returns the JSON bodies of the configured POST endpoints of the path. Bodies that can not be read are ignored.
+func (ct *ComplianceTest) configuredBodies(spec_path string) []interface{} {
+	var bodies []interface{}
+	for _, endpoints := range ct.endpoints {
+		for _, endpoint := range endpoints {
+			endpoint.loadVariablesToEndpoint(*ct)
+			if endpoint.Request_type != http.MethodPost || endpoint.Url != spec_path || endpoint.Body == "" {
+				continue
+			}
+			data := []byte(endpoint.Body)
+			if !isInlineBody(endpoint.Body) {
+				if ct.inlinebodies {
+					continue
+				}
+				var err error
+				if data, err = ioutil.ReadFile(endpoint.Body); err != nil {
+					continue
+				}
+			}
+			var body interface{}
+			if json.Unmarshal(data, &body) == nil {
+				bodies = append(bodies, body)
+			}
+		}
+	}
+	return bodies
+}
+
+// Applies a mutation of the kind to a copy of the body. Except for invalid from_node references, which
+// are only detected by the back end, a mutation is only applied if the mutated body does not match the schema.
+// Returns the mutated body, a description of the mutation and false if the kind is not applicable to the body.
+func fuzzBody(random *rand.Rand, schema *openapi3.Schema, body interface{}, kind string) (interface{}, string, bool) {
+	if kind == FUZZ_INVALID_NODE {
+		mutated := fuzzCopy(body)
+		pointer, ok := replaceFromNode(mutated, "")
+		if !ok {
+			pointer, ok = addFromNode(mutated, "")
+		}
+		return mutated, "from_node " + FUZZ_NODE + " at " + pointer, ok
+	}
+
+	locations := fuzzLocations(body, nil)
+	random.Shuffle(len(locations), func(i, j int) { locations[i], locations[j] = locations[j], locations[i] })
+
+	for _, location := range locations {
+		var candidates []interface{}
+		switch kind {
+		case FUZZ_MISSING_PROPERTY:
+			if _, ok := location[len(location)-1].(string); ok {
+				candidates = []interface{}{nil}
+			}
+		case FUZZ_WRONG_TYPE:
+			value := fuzzValue(body, location)
+			for _, candidate := range FUZZ_VALUES {
+				if fmt.Sprintf("%T", candidate) != fmt.Sprintf("%T", value) {
+					candidates = append(candidates, candidate)
+				}
+			}
+		case FUZZ_BOUNDARY_NUMBER:
+			if _, ok := fuzzValue(body, location).(float64); ok {
+				for _, number := range FUZZ_NUMBERS {
+					candidates = append(candidates, number)
+				}
+			}
+		case FUZZ_HUGE_STRING:
+			if _, ok := fuzzValue(body, location).(string); ok {
+				candidates = []interface{}{fuzzString}
+			}
+		}
+		random.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+		for _, candidate := range candidates {
+			mutated := fuzzCopy(body)
+			if kind == FUZZ_MISSING_PROPERTY {
+				mutated = fuzzSet(mutated, location, nil, true)
+			} else {
+				mutated = fuzzSet(mutated, location, candidate, false)
+			}
+			if schema.VisitJSON(mutated, openapi3.VisitAsRequest()) == nil {
+				continue
+			}
+
+			pointer := fuzzPointer(location)
+			switch kind {
+			case FUZZ_MISSING_PROPERTY:
+				return mutated, "removed " + pointer, true
+			case FUZZ_HUGE_STRING:
+				return mutated, fmt.Sprintf("string of %d bytes at %s", len(candidate.(string)), pointer), true
+			default:
+				data, _ := json.Marshal(candidate)
+				return mutated, "set " + pointer + " to " + string(data), true
+			}
+		}
+	}
+
+	return nil, "", false
+}
+
+// Returns the locations of all values in the body, as lists of property names and array indices
+func fuzzLocations(value interface{}, location []interface{}) [][]interface{} {
+	var locations [][]interface{}
+	if len(location) > 0 {
+		locations = append(locations, location)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var names []string
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := append(append([]interface{}{}, location...), name)
+			locations = append(locations, fuzzLocations(v[name], child)...)
+		}
+	case []interface{}:
+		for index, item := range v {
+			child := append(append([]interface{}{}, location...), index)
+			locations = append(locations, fuzzLocations(item, child)...)
+		}
+	}
+	return locations
+}
+
+// Returns the value at the location of the body
+func fuzzValue(value interface{}, location []interface{}) interface{} {
+	for _, step := range location {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[step.(string)]
+		case []interface{}:
+			value = v[step.(int)]
+		}
+	}
+	return value
+}
+
+// Sets or removes the value at the location of the body. Returns the changed body.
+func fuzzSet(value interface{}, location []interface{}, replacement interface{}, remove bool) interface{} {
+	if len(location) == 0 {
+		return replacement
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		name := location[0].(string)
+		if len(location) == 1 && remove {
+			delete(v, name)
+		} else {
+			v[name] = fuzzSet(v[name], location[1:], replacement, remove)
+		}
+	case []interface{}:
+		index := location[0].(int)
+		if len(location) == 1 && remove {
+			return append(v[:index], v[index+1:]...)
+		}
+		v[index] = fuzzSet(v[index], location[1:], replacement, remove)
+	}
+	return value
+}
+
+// Returns the location as JSON pointer
+func fuzzPointer(location []interface{}) string {
+	pointer := ""
+	for _, step := range location {
+		pointer += "/" + strings.Replace(strings.Replace(fmt.Sprint(step), "~", "~0", -1), "/", "~1", -1)
+	}
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
+
+// Returns a deep copy of a JSON value
+func fuzzCopy(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var copied interface{}
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+// Replaces the first from_node reference in the body with a node that does not exist.
+// Returns the JSON pointer of the reference and false if there is none.
+func replaceFromNode(value interface{}, pointer string) (string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v["from_node"].(string); ok {
+			v["from_node"] = FUZZ_NODE
+			return pointer + "/from_node", true
+		}
+		var names []string
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if found, ok := replaceFromNode(v[name], pointer+"/"+name); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for index, item := range v {
+			if found, ok := replaceFromNode(item, pointer+"/"+strconv.Itoa(index)); ok {
+				return found, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Replaces the first argument of the first node of a process graph in the body with a reference to
+// a node that does not exist. Returns the JSON pointer of the argument and false if there is no process graph.
+func addFromNode(value interface{}, pointer string) (string, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	if graph, ok := object["process_graph"].(map[string]interface{}); ok {
+		var nodes []string
+		for node := range graph {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		for _, node := range nodes {
+			process, ok := graph[node].(map[string]interface{})
+			if !ok || process["process_id"] == nil {
+				continue
+			}
+			arguments, ok := process["arguments"].(map[string]interface{})
+			if !ok {
+				arguments = make(map[string]interface{})
+				process["arguments"] = arguments
+			}
+			argument := "data"
+			var names []string
+			for name := range arguments {
+				names = append(names, name)
+			}
+			if len(names) > 0 {
+				sort.Strings(names)
+				argument = names[0]
+			}
+			arguments[argument] = map[string]interface{}{"from_node": FUZZ_NODE}
+			return pointer + "/process_graph/" + node + "/arguments/" + argument, true
+		}
+	}
+
+	var names []string
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if found, ok := addFromNode(object[name], pointer+"/"+name); ok {
+			return found, true
+		}
+	}
+	return "", false
+}
+
+// Sends a mutated body and checks that the back end answers with an openEO error with a 4xx response code.
+// Returns the resulting state and an error message if the back end accepted the body or failed.
+func (ct *ComplianceTest) sendFuzzRequest(spec_path string, body interface{}, description string) (string, *ErrorMessage) {
+
+	input := http.MethodPost + "  " + spec_path + " with " + description
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = input
+		errormsg.msg = "Error encoding the request body"
+		errormsg.output = err.Error()
+		return "Error", errormsg
+	}
+
+	client := ct.newClient(30 * time.Second)
+
+	httpReq, _ := http.NewRequest(http.MethodPost, build_url(ct.backend.url, spec_path), bytes.NewReader(data))
+	httpReq.Header.Set("Content-Type", "application/json")
+	setBearer(httpReq, ct.token)
+
+	if ct.debug {
+		log.Println(ct.mask("Fuzzing " + input))
+	}
+
+	resp, err := client.Do(httpReq)
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = input
+		errormsg.msg = "Error sending request to back end"
+		errormsg.output = string(err.Error())
+		return "Error", errormsg
+	}
+
+	resp_body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 400 {
+		// Accepted bodies may have created a job or process graph
+		ct.trackResource(http.MethodPost, spec_path, resp.Header)
+	}
+
+	if resp.StatusCode < 400 || resp.StatusCode >= 500 {
+		errormsg := new(ErrorMessage)
+		errormsg.input = input
+		errormsg.msg = "Response Code " + strconv.Itoa(resp.StatusCode) + " instead of 4xx"
+		errormsg.output = string(resp_body)
+		return "Invalid", errormsg
+	}
+
+	var openeo_error map[string]interface{}
+	json.Unmarshal(resp_body, &openeo_error)
+	_, has_code := openeo_error["code"].(string)
+	_, has_message := openeo_error["message"].(string)
+	if !has_code || !has_message {
+		errormsg := new(ErrorMessage)
+		errormsg.input = input
+		errormsg.msg = "Response is not a JSON openEO error with code and message"
+		errormsg.output = string(resp_body)
+		return "Invalid", errormsg
+	}
+
+	return warningState(input, checkWarnings(WarningResponse{
+		Method: http.MethodPost,
+		Path:   spec_path,
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   resp_body}))
+}
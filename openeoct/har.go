@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// HarFile "class", a HTTP Archive as exported by browsers and proxies
+type HarFile struct {
+	Log struct {
+		Entries []HarEntry `json:"entries"`
+	} `json:"log"`
+}
+
+// Creates the command to validate captured traffic in HAR files
+func harCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "har",
+		Usage:     "validate the requests and responses captured in HAR files, without sending any request",
+		ArgsUsage: "HAR_FILE...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "openapi",
+				Usage: "file or url of the openEO API definition",
+			},
+			&cli.StringFlag{
+				Name:  "backend",
+				Usage: "url of the back end, only requests to its host are validated and its path is removed from the urls",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "file the validation report is written to",
+			},
+			&cli.StringFlag{
+				Name:  "formats",
+				Value: "lenient",
+				Usage: "handling of the formats of strings, strict, lenient or warn",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ct := new(ComplianceTest)
+			if err := ct.applyGlobalFlags(c); err != nil {
+				return err
+			}
+
+			if c.Args().Len() == 0 {
+				return fmt.Errorf("No HAR file specified")
+			}
+			if c.String("openapi") == "" {
+				return fmt.Errorf("No openEO API definition specified")
+			}
+			ct.apifile = c.String("openapi")
+			ct.output = c.String("output")
+			formats, err := formatMode(c.String("formats"))
+			if err != nil {
+				return err
+			}
+			ct.formats = formats
+			ct.backend.baseurl = c.String("backend")
+			ct.backend.url = c.String("backend")
+			ct.variables = make(map[string]string)
+
+			report, err := ct.validateHarFiles(c.Args().Slice())
+			if err != nil {
+				return err
+			}
+			ct.writeReport(report)
+			os.Exit(report.exitCode(ct.failoninvalid, ct.failonwarnings))
+			return nil
+		},
+	}
+}
+
+// Reads the entries of a HAR file. Files containing a single entry, as written by the record flag,
+// are read as well.
+func readHarEntries(file string) ([]HarEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading HAR file: %v", err)
+	}
+
+	var har HarFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("Error reading HAR file %s: %v", file, err)
+	}
+	if len(har.Log.Entries) > 0 {
+		return har.Log.Entries, nil
+	}
+
+	var entry HarEntry
+	if err := json.Unmarshal(data, &entry); err == nil && entry.Request.Method != "" {
+		return []HarEntry{entry}, nil
+	}
+
+	return nil, fmt.Errorf("No entries found in HAR file: %s", file)
+}
+
+// Validates the entries of the HAR files, one group per file.
+// Returns the report in the same format as the validation of a config.
+func (ct *ComplianceTest) validateHarFiles(files []string) (Report, error) {
+	start_time := time.Now()
+
+	if _, errLoad := ct.loadRouter(); errLoad != nil {
+		return nil, fmt.Errorf("%s", errLoad.toString())
+	}
+
+	var backend *url.URL
+	if ct.backend.url != "" {
+		var err error
+		if backend, err = url.Parse(ct.backend.url); err != nil {
+			return nil, fmt.Errorf("Invalid backend url: %v", err)
+		}
+	}
+
+	ct.endpoints = make(map[string][]Endpoint)
+	result := make(map[string](map[string]string))
+	counter := 0
+
+	for _, file := range files {
+		entries, err := readHarEntries(file)
+		if err != nil {
+			return nil, err
+		}
+		group := filepath.Base(file)
+
+		for _, entry := range entries {
+			// CORS preflight requests of browsers are not part of the openEO API
+			if entry.Request.Method == http.MethodOptions {
+				continue
+			}
+
+			req_url, err := url.Parse(entry.Request.Url)
+			if err != nil {
+				continue
+			}
+			if backend != nil && req_url.Host != backend.Host {
+				continue
+			}
+
+			counter++
+			endpoint := Endpoint{
+				Id:           fmt.Sprintf("%04d", counter),
+				Url:          req_url.Path,
+				Request_type: entry.Request.Method,
+				Group:        group,
+			}
+
+			state, errmsg := ct.validateHarEntry(&endpoint, entry, req_url, backend)
+			result[endpoint.Id] = map[string]string{"state": state, "message": ""}
+			if errmsg != nil {
+				result[endpoint.Id]["message"] = errmsg.toString()
+			}
+			ct.endpoints[group] = append(ct.endpoints[group], endpoint)
+			ct.reportProgress(endpoint, result[endpoint.Id])
+		}
+	}
+
+	report := ct.buildReport(result, start_time, time.Now())
+	ct.maskReport(report)
+	return report, nil
+}
+
+// Validates a single HAR entry. The url of the endpoint is set to the path of the request relative
+// to the back end, which is the path matching a route of the openEO API if no back end url is given.
+func (ct *ComplianceTest) validateHarEntry(endpoint *Endpoint, entry HarEntry, req_url *url.URL, backend *url.URL) (string, *ErrorMessage) {
+	endpoint.Url = ct.relativePath(endpoint.Request_type, req_url, backend)
+
+	relative_url := endpoint.Url
+	if req_url.RawQuery != "" {
+		relative_url += "?" + req_url.RawQuery
+	}
+
+	var reqbody []byte
+	var err error
+	if entry.Request.PostData != nil {
+		reqbody = []byte(entry.Request.PostData.Text)
+		if entry.Request.PostData.Encoding == "base64" {
+			if reqbody, err = base64.StdEncoding.DecodeString(entry.Request.PostData.Text); err != nil {
+				errormsg := new(ErrorMessage)
+				errormsg.input = entry.Request.Method + "  " + endpoint.Url
+				errormsg.msg = "Error decoding the request body of the HAR entry"
+				errormsg.output = err.Error()
+				return "Error", errormsg
+			}
+		}
+	}
+	httpReq, err := http.NewRequest(entry.Request.Method, relative_url, bytes.NewReader(reqbody))
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = entry.Request.Method + "  " + endpoint.Url
+		errormsg.msg = "Error reading the request of the HAR entry"
+		errormsg.output = err.Error()
+		return "Error", errormsg
+	}
+	httpReq.Header = fromHarHeaders(entry.Request.Headers)
+	if entry.Request.PostData == nil {
+		httpReq.Body = nil
+	}
+
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		if body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil {
+			errormsg := new(ErrorMessage)
+			errormsg.input = entry.Request.Method + "  " + endpoint.Url
+			errormsg.msg = "Error decoding the response body of the HAR entry"
+			errormsg.output = err.Error()
+			return "Error", errormsg
+		}
+	}
+
+	resp := &http.Response{
+		StatusCode: entry.Response.Status,
+		Header:     fromHarHeaders(entry.Response.Headers),
+	}
+
+	exchange := ct.recordRequest(*endpoint, httpReq)
+	exchange.Url = entry.Request.Url
+	exchange.recordResponse(resp, body)
+
+	return ct.validateExchange(*endpoint, httpReq, resp, body, exchange)
+}
+
+// Returns the path of the request relative to the back end url. Without back end url, leading path
+// elements are removed until the path matches a route of the openEO API.
+func (ct *ComplianceTest) relativePath(method string, req_url *url.URL, backend *url.URL) string {
+	req_path := req_url.Path
+	if req_path == "" {
+		req_path = "/"
+	}
+
+	if backend != nil {
+		base_path := strings.TrimSuffix(backend.Path, "/")
+		if base_path != "" && (req_path == base_path || strings.HasPrefix(req_path, base_path+"/")) {
+			req_path = "/" + strings.TrimPrefix(strings.TrimPrefix(req_path, base_path), "/")
+		}
+		return req_path
+	}
+
+	for candidate := req_path; ; {
+		if _, _, err := ct.router.FindRoute(method, &url.URL{Path: candidate}); err == nil {
+			return candidate
+		}
+		index := strings.Index(strings.TrimPrefix(candidate, "/"), "/")
+		if index < 0 {
+			return req_path
+		}
+		candidate = candidate[index+1:]
+	}
+}
+
+// Validates a request, with an url relative to the back end, and the received response against the
+// openEO API, without sending any request. Used for captured traffic.
+func (ct *ComplianceTest) validateExchange(endpoint Endpoint, httpReq *http.Request, resp *http.Response, body []byte, exchange *Exchange) (string, *ErrorMessage) {
+	// Format mismatches of the request and the response, collected if formats only warn
+	var format_warnings []string
+
+	requestValidationInput, errormsg := ct.validateRequest(endpoint, httpReq, &format_warnings)
+	if errormsg != nil {
+		return "Invalid", errormsg
+	}
+
+	if errormsg := ct.validateResponse(endpoint, requestValidationInput, resp, body, exchange); errormsg != nil {
+		return "Invalid", errormsg
+	}
+
+	// Error responses matching the openEO API are valid, except for failures of the back end
+	if resp.StatusCode >= 500 {
+		errormsg := new(ErrorMessage)
+		errormsg.input = endpoint.Url
+		errormsg.msg = "Response Code " + strconv.Itoa(resp.StatusCode)
+		errormsg.output = string(body)
+		return "Error", errormsg
+	}
+
+	return warningState(httpReq.Method+"  "+endpoint.Url, responseWarnings(requestValidationInput, resp, body, format_warnings))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Exit code of the diff command if at least one endpoint regressed
+const EXIT_REGRESSION = 2
+
+// Time format of the names of the reports in the history directory
+const HISTORY_FILE_FORMAT = "20060102-150405.000000000"
+
+// Kinds of changes between two reports
+const (
+	CHANGE_ADDED     = "added"
+	CHANGE_REMOVED   = "removed"
+	CHANGE_REGRESSED = "regressed"
+	CHANGE_FIXED     = "fixed"
+	CHANGE_STATE     = "state"
+	CHANGE_DETAILS   = "details"
+)
+
+// ReportChange "class", the change of a single endpoint between two reports
+type ReportChange struct {
+	Change     string `json:"change"`
+	Group      string `json:"group"`
+	Id         string `json:"id"`
+	Url        string `json:"url"`
+	Type       string `json:"type"`
+	OldState   string `json:"old_state,omitempty"`
+	NewState   string `json:"new_state,omitempty"`
+	OldMessage string `json:"old_message,omitempty"`
+	NewMessage string `json:"new_message,omitempty"`
+}
+
+// ReportDiff "class", the differences between two reports
+type ReportDiff struct {
+	Old     map[string]interface{} `json:"old"`
+	New     map[string]interface{} `json:"new"`
+	Summary map[string]int         `json:"summary"`
+	Changes []ReportChange         `json:"changes"`
+}
+
+// Returns the sub directory of the history directory of the config for the back end
+func (ct *ComplianceTest) historyDir() string {
+	backend_dir := regexp.MustCompile(`[^A-Za-z0-9.-]+`).ReplaceAllString(regexp.MustCompile(`^[a-z]+://`).ReplaceAllString(ct.backend.url, ""), "_")
+	return filepath.Join(ReturnConfigValue(ct.history), backend_dir)
+}
+
+// Stores the report in the history directory of the config, in a sub directory per back end.
+func (ct *ComplianceTest) saveHistory(result_json Report) {
+	dir := ct.historyDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Println("Warning: Failed to create history directory: ", dir, err)
+		return
+	}
+
+	jsonString, _ := json.MarshalIndent(result_json, "", "    ")
+	// The file names are timestamps with nanoseconds, so that they sort in the order of the runs.
+	// Existing reports are never overwritten, the timestamp is taken again instead.
+	for {
+		file := filepath.Join(dir, time.Now().Format(HISTORY_FILE_FORMAT)+".json")
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err == nil {
+			_, err = f.Write(jsonString)
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+		}
+		if err != nil {
+			log.Println("Warning: Failed to write report to history: ", file, err)
+		}
+		return
+	}
+}
+
+// Creates the command to compare two reports
+func diffCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "compare two validation reports, or the two latest reports of a history directory",
+		ArgsUsage: "OLD_REPORT NEW_REPORT | HISTORY_DIR",
+		Action: func(c *cli.Context) error {
+			var old_file, new_file string
+
+			if c.Args().Len() == 2 {
+				old_file = c.Args().Get(0)
+				new_file = c.Args().Get(1)
+			} else if c.Args().Len() == 1 {
+				files, _ := filepath.Glob(filepath.Join(c.Args().Get(0), "*.json"))
+				if len(files) < 2 {
+					return fmt.Errorf("Less than two reports found in history directory: %s", c.Args().Get(0))
+				}
+				// The file names are timestamps, so the latest reports are the last ones
+				sort.Strings(files)
+				old_file = files[len(files)-2]
+				new_file = files[len(files)-1]
+			} else {
+				return fmt.Errorf("Expected two reports or a history directory")
+			}
+
+			old_report, err := loadReport(old_file)
+			if err != nil {
+				return err
+			}
+			new_report, err := loadReport(new_file)
+			if err != nil {
+				return err
+			}
+
+			diff := diffReports(old_report, new_report)
+			jsonString, _ := json.MarshalIndent(diff, "", "    ")
+			fmt.Println(string(jsonString))
+
+			if diff.Summary[CHANGE_REGRESSED] > 0 {
+				os.Exit(EXIT_REGRESSION)
+			}
+			return nil
+		},
+	}
+}
+
+// Reads a report written by the validator
+func loadReport(file string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading report: %v", err)
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("Error reading report %s: %v", file, err)
+	}
+	return report, nil
+}
+
+// Returns the endpoints of a report keyed by group and id
+func reportEndpoints(report map[string]interface{}) map[[2]string](map[string]string) {
+	endpoints := make(map[[2]string](map[string]string))
+
+	groups, _ := report["result"].(map[string]interface{})
+	for group_name, group := range groups {
+		group_map, _ := group.(map[string]interface{})
+		group_endpoints, _ := group_map["endpoints"].(map[string]interface{})
+		for id, endpoint := range group_endpoints {
+			endpoint_map, _ := endpoint.(map[string]interface{})
+			state := make(map[string]string)
+			for key, value := range endpoint_map {
+				if str, ok := value.(string); ok {
+					state[key] = str
+				}
+			}
+			endpoints[[2]string{group_name, id}] = state
+		}
+	}
+
+	return endpoints
+}
+
+// Returns whether the state of an endpoint passes the validation, endpoints with warnings pass
+func isPassing(state string) bool {
+	return state == "Valid" || state == "Warning"
+}
+
+// Compares the endpoints of two reports.
+// Endpoints are identified by group and id, an endpoint that moved to another group is removed and added.
+func diffReports(old_report map[string]interface{}, new_report map[string]interface{}) ReportDiff {
+	diff := ReportDiff{
+		Summary: make(map[string]int),
+		Changes: []ReportChange{},
+	}
+	diff.Old, _ = old_report["stats"].(map[string]interface{})
+	diff.New, _ = new_report["stats"].(map[string]interface{})
+
+	old_endpoints := reportEndpoints(old_report)
+	new_endpoints := reportEndpoints(new_report)
+
+	for key, old_ep := range old_endpoints {
+		new_ep, ok := new_endpoints[key]
+		change := ReportChange{
+			Group:      key[0],
+			Id:         key[1],
+			Url:        old_ep["url"],
+			Type:       old_ep["type"],
+			OldState:   old_ep["state"],
+			OldMessage: old_ep["message"],
+		}
+
+		if !ok {
+			change.Change = CHANGE_REMOVED
+		} else {
+			change.Url = new_ep["url"]
+			change.Type = new_ep["type"]
+			change.NewState = new_ep["state"]
+			change.NewMessage = new_ep["message"]
+
+			if isPassing(old_ep["state"]) && !isPassing(new_ep["state"]) && new_ep["state"] != "NotSupported" {
+				change.Change = CHANGE_REGRESSED
+			} else if !isPassing(old_ep["state"]) && isPassing(new_ep["state"]) {
+				change.Change = CHANGE_FIXED
+			} else if old_ep["state"] != new_ep["state"] {
+				change.Change = CHANGE_STATE
+			} else if old_ep["message"] != new_ep["message"] {
+				change.Change = CHANGE_DETAILS
+			} else {
+				continue
+			}
+		}
+
+		diff.Changes = append(diff.Changes, change)
+	}
+
+	for key, new_ep := range new_endpoints {
+		if _, ok := old_endpoints[key]; ok {
+			continue
+		}
+		diff.Changes = append(diff.Changes, ReportChange{
+			Change:     CHANGE_ADDED,
+			Group:      key[0],
+			Id:         key[1],
+			Url:        new_ep["url"],
+			Type:       new_ep["type"],
+			NewState:   new_ep["state"],
+			NewMessage: new_ep["message"],
+		})
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		if diff.Changes[i].Group != diff.Changes[j].Group {
+			return diff.Changes[i].Group < diff.Changes[j].Group
+		}
+		return diff.Changes[i].Id < diff.Changes[j].Id
+	})
+
+	for _, change := range diff.Changes {
+		diff.Summary[change.Change]++
+	}
+
+	return diff
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+// Returns a report as loaded from a file, with the endpoints given as group, id, state and message
+func testReport(endpoints ...[4]string) map[string]interface{} {
+	groups := make(map[string]interface{})
+	for _, endpoint := range endpoints {
+		if groups[endpoint[0]] == nil {
+			groups[endpoint[0]] = map[string]interface{}{"endpoints": map[string]interface{}{}}
+		}
+		group_endpoints := groups[endpoint[0]].(map[string]interface{})["endpoints"].(map[string]interface{})
+		group_endpoints[endpoint[1]] = map[string]interface{}{
+			"state":   endpoint[2],
+			"message": endpoint[3],
+			"url":     "/" + endpoint[1],
+			"type":    "GET",
+		}
+	}
+	return map[string]interface{}{"result": groups, "stats": map[string]interface{}{}}
+}
+
+func TestDiffReportsChange(t *testing.T) {
+	tests := []struct {
+		old_state   string
+		old_message string
+		new_state   string
+		new_message string
+		change      string
+	}{
+		{"Valid", "", "Valid", "", ""},
+		{"Invalid", "a", "Invalid", "a", ""},
+		{"Valid", "", "Invalid", "b", CHANGE_REGRESSED},
+		{"Valid", "", "Error", "b", CHANGE_REGRESSED},
+		{"Valid", "", "Missing", "", CHANGE_REGRESSED},
+		{"Warning", "w", "Invalid", "b", CHANGE_REGRESSED},
+		{"Invalid", "a", "Valid", "", CHANGE_FIXED},
+		{"Error", "a", "Warning", "w", CHANGE_FIXED},
+		{"NotSupported", "", "Valid", "", CHANGE_FIXED},
+		{"Missing", "", "Valid", "", CHANGE_FIXED},
+		// Skipped endpoints are no regression, e.g. if the back end stopped supporting them
+		{"Valid", "", "NotSupported", "", CHANGE_STATE},
+		{"Valid", "", "Warning", "w", CHANGE_STATE},
+		{"Invalid", "a", "Error", "a", CHANGE_STATE},
+		{"NotSupported", "", "Invalid", "b", CHANGE_STATE},
+		{"Invalid", "a", "Invalid", "b", CHANGE_DETAILS},
+		{"Warning", "w", "Warning", "x", CHANGE_DETAILS},
+	}
+	for _, test := range tests {
+		diff := diffReports(
+			testReport([4]string{"Processes", "processes", test.old_state, test.old_message}),
+			testReport([4]string{"Processes", "processes", test.new_state, test.new_message}))
+		change := ""
+		if len(diff.Changes) == 1 {
+			change = diff.Changes[0].Change
+		}
+		if len(diff.Changes) > 1 || change != test.change {
+			t.Errorf("%s (%s) -> %s (%s) = %v, expected %q", test.old_state, test.old_message, test.new_state, test.new_message, diff.Changes, test.change)
+		}
+	}
+}
+
+func TestDiffReports(t *testing.T) {
+	old_report := testReport(
+		[4]string{"Jobs", "jobs", "Valid", ""},
+		[4]string{"Jobs", "job", "Invalid", "a"},
+		[4]string{"Processes", "processes", "Valid", ""},
+		[4]string{"Processes", "udp", "Valid", ""},
+	)
+	new_report := testReport(
+		[4]string{"Jobs", "jobs", "Invalid", "b"},
+		[4]string{"Jobs", "job", "Valid", ""},
+		[4]string{"Processes", "processes", "Valid", ""},
+		[4]string{"UDPs", "udp", "Valid", ""},
+	)
+
+	diff := diffReports(old_report, new_report)
+
+	expected := []ReportChange{
+		{Change: CHANGE_FIXED, Group: "Jobs", Id: "job", Url: "/job", Type: "GET", OldState: "Invalid", NewState: "Valid", OldMessage: "a"},
+		{Change: CHANGE_REGRESSED, Group: "Jobs", Id: "jobs", Url: "/jobs", Type: "GET", OldState: "Valid", NewState: "Invalid", NewMessage: "b"},
+		{Change: CHANGE_REMOVED, Group: "Processes", Id: "udp", Url: "/udp", Type: "GET", OldState: "Valid"},
+		{Change: CHANGE_ADDED, Group: "UDPs", Id: "udp", Url: "/udp", Type: "GET", NewState: "Valid"},
+	}
+	if len(diff.Changes) != len(expected) {
+		t.Fatalf("diffReports = %v, expected %v", diff.Changes, expected)
+	}
+	for i := range expected {
+		if diff.Changes[i] != expected[i] {
+			t.Errorf("change %d = %v, expected %v", i, diff.Changes[i], expected[i])
+		}
+	}
+	for _, change := range []string{CHANGE_FIXED, CHANGE_REGRESSED, CHANGE_REMOVED, CHANGE_ADDED} {
+		if diff.Summary[change] != 1 {
+			t.Errorf("summary of %s = %d, expected 1", change, diff.Summary[change])
+		}
+	}
+}
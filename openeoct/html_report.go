@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3filter"
+)
+
+// Exchange "class", the request sent to the back end for an endpoint and the received response
+type Exchange struct {
+	Method         string
+	Url            string
+	RequestHeader  http.Header
+	RequestBody    string
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   string
+	// JSON pointers to the parts of the response body that did not match the schema or the assertions
+	Pointers []string
+	// Durations of the request, nil if the request was not sent by the compliance test
+	Timing *Timing
+}
+
+// Records the request of an endpoint, the body of the request is restored after reading it.
+func (ct *ComplianceTest) recordRequest(endpoint Endpoint, req *http.Request) *Exchange {
+	exchange := &Exchange{
+		Method:        req.Method,
+		Url:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+	}
+
+	if req.Body != nil {
+		reqbody, _ := ioutil.ReadAll(req.Body)
+		exchange.RequestBody = string(reqbody)
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqbody))
+	}
+
+	if ct.exchanges == nil {
+		ct.exchanges = make(map[string]*Exchange)
+	}
+	ct.exchanges[endpoint.Id] = exchange
+	return exchange
+}
+
+// Records the response of an endpoint
+func (exchange *Exchange) recordResponse(resp *http.Response, body []byte) {
+	exchange.Status = resp.StatusCode
+	exchange.ResponseHeader = resp.Header.Clone()
+	exchange.ResponseBody = string(body)
+}
+
+// Records the JSON pointer of a schema error of the response
+func (exchange *Exchange) recordError(err error) {
+	if respErr, ok := err.(*openapi3filter.ResponseError); ok {
+		err = respErr.Err
+	}
+	if schemaErr, ok := err.(*openapi3.SchemaError); ok {
+		exchange.Pointers = append(exchange.Pointers, jsonPointer(schemaErr.JSONPointer()))
+	}
+}
+
+// Builds a JSON pointer string out of the path elements
+func jsonPointer(path []string) string {
+	pointer := ""
+	for _, element := range path {
+		element = strings.Replace(element, "~", "~0", -1)
+		element = strings.Replace(element, "/", "~1", -1)
+		pointer += "/" + element
+	}
+	return pointer
+}
+
+// Renders a JSON body as indented HTML, highlighting the values at the given JSON pointers.
+// Bodies that are no valid JSON are rendered as escaped text.
+func renderJsonBody(body string, pointers []string) template.HTML {
+	var value interface{}
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	if body == "" || dec.Decode(&value) != nil {
+		return template.HTML(template.HTMLEscapeString(body))
+	}
+
+	marked := make(map[string]bool)
+	for _, pointer := range pointers {
+		marked[pointer] = true
+	}
+
+	buf := new(bytes.Buffer)
+	renderJsonValue(buf, value, "", marked, "")
+	return template.HTML(buf.String())
+}
+
+func renderJsonValue(buf *bytes.Buffer, value interface{}, pointer string, marked map[string]bool, indent string) {
+	if marked[pointer] {
+		fmt.Fprintf(buf, `<mark title="Error at %s">`, template.HTMLEscapeString(pointerOrRoot(pointer)))
+		defer buf.WriteString("</mark>")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteString("{\n")
+		for i, key := range keys {
+			key_json, _ := json.Marshal(key)
+			buf.WriteString(indent + "    " + template.HTMLEscapeString(string(key_json)) + ": ")
+			renderJsonValue(buf, v[key], pointer+jsonPointer([]string{key}), marked, indent+"    ")
+			if i < len(keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			buf.WriteString(indent + "    ")
+			renderJsonValue(buf, item, pointer+jsonPointer([]string{fmt.Sprint(i)}), marked, indent+"    ")
+			if i < len(v)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		value_json, _ := json.Marshal(v)
+		buf.WriteString(template.HTMLEscapeString(string(value_json)))
+	}
+}
+
+func pointerOrRoot(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
+
+// Renders the headers of a request or response as sorted text lines
+func renderHeader(header http.Header) string {
+	var lines []string
+	for name, values := range header {
+		lines = append(lines, name+": "+strings.Join(values, ", "))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// HtmlEndpoint "class", an endpoint row of the HTML report
+type HtmlEndpoint struct {
+	Id       string
+	Url      string
+	Type     string
+	State    string
+	Message  string
+	Duration string
+	Exchange *Exchange
+	Request  string
+	Response template.HTML
+}
+
+// HtmlGroup "class", a group of the HTML report
+type HtmlGroup struct {
+	Name      string
+	Summary   string
+	Counts    map[string]int
+	Durations interface{}
+	Endpoints []HtmlEndpoint
+}
+
+// Renders the report as a single HTML file, including the requests and responses of the endpoints.
+func (ct *ComplianceTest) renderHtmlReport(result_json Report) []byte {
+	var groups []HtmlGroup
+	states := make(map[string]bool)
+
+	for group_name, group := range result_json["result"] {
+		html_group := HtmlGroup{
+			Name:      group_name,
+			Summary:   fmt.Sprint(group["group_summary"]),
+			Counts:    make(map[string]int),
+			Durations: group["durations"],
+		}
+		endpoints, _ := group["endpoints"].(map[string](map[string]string))
+		for id, state := range endpoints {
+			html_ep := HtmlEndpoint{
+				Id:       id,
+				Url:      state["url"],
+				Type:     state["type"],
+				State:    state["state"],
+				Message:  state["message"],
+				Duration: state["duration"],
+			}
+			// Built-in groups have no recorded exchanges, their ids may equal the ones of configured endpoints
+			if exchange, ok := ct.exchanges[id]; ok && ct.isConfiguredGroup(group_name) {
+				html_ep.Exchange = exchange
+				html_ep.Request = ct.mask(exchange.Method + " " + exchange.Url + "\n" + renderHeader(ct.maskHeader(exchange.RequestHeader)))
+				if exchange.RequestBody != "" {
+					html_ep.Request += "\n\n" + ct.mask(exchange.RequestBody)
+				}
+				response := template.HTMLEscapeString(fmt.Sprintf("Status: %d\n%s", exchange.Status, renderHeader(ct.maskHeader(exchange.ResponseHeader))))
+				html_ep.Response = template.HTML(response+"\n\n") + renderJsonBody(ct.mask(exchange.ResponseBody), exchange.Pointers)
+			}
+			html_group.Endpoints = append(html_group.Endpoints, html_ep)
+			html_group.Counts[state["state"]]++
+			states[state["state"]] = true
+		}
+		sort.Slice(html_group.Endpoints, func(i, j int) bool { return html_group.Endpoints[i].Id < html_group.Endpoints[j].Id })
+		groups = append(groups, html_group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	var state_list []string
+	for state := range states {
+		state_list = append(state_list, state)
+	}
+	sort.Strings(state_list)
+
+	buf := new(bytes.Buffer)
+	err := htmlReportTemplate.Execute(buf, map[string]interface{}{
+		"Stats":  result_json["stats"],
+		"Groups": groups,
+		"States": state_list,
+	})
+	if err != nil {
+		return []byte(template.HTMLEscapeString(err.Error()))
+	}
+	return buf.Bytes()
+}
+
+// Checks if the group contains endpoints of the config
+func (ct *ComplianceTest) isConfiguredGroup(group string) bool {
+	_, ok := ct.endpoints[group]
+	return ok
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>openEO compliance test report</title>
+<style>
+	body { font-family: sans-serif; font-size: 10pt; margin: 1em 2em; }
+	dl.stats { display: grid; grid-template-columns: max-content auto; gap: .2em 1em; }
+	dl.stats dt { font-weight: bold; }
+	dl.stats dd { margin: 0; }
+	.filter { margin: 1em 0; padding: .5em; background-color: #eee; }
+	.filter label { margin-right: 1em; }
+	h2 { padding: .2em .5em; }
+	h2 .counts { font-size: 70%; font-weight: normal; margin-left: 1em; }
+	table { border-collapse: collapse; width: 100%; }
+	th { text-align: left; }
+	td { border: 1px solid #aaa; padding: .2em .5em; vertical-align: top; }
+	td.message { font-size: 90%; }
+	.state { background-color: #ddd; }
+	.state-error, .state-invalid, .state-missing { background-color: #fcc; color: #400; }
+	.state-notsupported { background-color: #fed; color: #432; }
+	.state-valid { background-color: #cfc; color: #040; }
+	.state-warning { background-color: #ffc; color: #440; }
+	details pre { background-color: #fff; color: #000; padding: .5em; overflow: auto; max-height: 40em; }
+	mark { background-color: #f88; }
+</style>
+</head>
+<body>
+<h1>openEO compliance test report</h1>
+<dl class="stats">
+{{- range $section, $values := .Stats}}
+	{{- range $key, $value := $values}}
+	<dt>{{$section}}: {{$key}}</dt><dd>{{$value}}</dd>
+	{{- end}}
+{{- end}}
+</dl>
+<div class="filter">
+	<label>Filter: <input type="search" id="filter-text" placeholder="id, url or message"></label>
+	{{- range .States}}
+	<label><input type="checkbox" class="filter-state" value="{{lower .}}" checked> {{.}}</label>
+	{{- end}}
+</div>
+{{- range .Groups}}
+<section class="group">
+<h2 class="state state-{{lower .Summary}}">{{.Name}}: {{.Summary}}<span class="counts">
+	{{- range $state, $count := .Counts}} {{$state}}: {{$count}}{{end}}
+	{{- if .Durations}} &ndash; durations in ms:{{range $percentile, $ms := .Durations}} {{$percentile}}: {{$ms}}{{end}}{{end}}</span></h2>
+<table>
+<thead><tr><th>id</th><th>method</th><th>url</th><th>state</th><th>duration (ms)</th><th>message</th></tr></thead>
+<tbody>
+{{- range .Endpoints}}
+<tr class="endpoint state state-{{lower .State}}" data-state="{{lower .State}}">
+	<td>{{.Id}}</td><td><code>{{.Type}}</code></td><td><code>{{.Url}}</code></td><td>{{.State}}</td><td>{{.Duration}}</td>
+	<td class="message">{{.Message}}
+	{{- if .Exchange}}
+		<details><summary>Request</summary><pre>{{.Request}}</pre></details>
+		<details><summary>Response</summary><pre>{{.Response}}</pre></details>
+	{{- end}}
+	</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+</section>
+{{- end}}
+<script>
+	function applyFilter() {
+		var text = document.getElementById("filter-text").value.toLowerCase();
+		var states = {};
+		document.querySelectorAll(".filter-state").forEach(function(box) { states[box.value] = box.checked; });
+		document.querySelectorAll("tr.endpoint").forEach(function(row) {
+			var visible = states[row.dataset.state] !== false && row.textContent.toLowerCase().indexOf(text) >= 0;
+			row.style.display = visible ? "" : "none";
+		});
+	}
+	document.getElementById("filter-text").addEventListener("input", applyFilter);
+	document.querySelectorAll(".filter-state").forEach(function(box) { box.addEventListener("change", applyFilter); });
+</script>
+</body>
+</html>
+`))
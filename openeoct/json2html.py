@@ -24,6 +24,7 @@ def main(input_path=None, output_path=None):
             .state-error, .state-invalid, .state-missing { background-color: #fcc; color: #400; }
             .state-notsupported { background-color: #fed; color: #432; }
             .state-valid { background-color: #cfc; color: #040; }
+            .state-warning { background-color: #ffc; color: #440; }
             td.message { font-size: 80%; }
             </style>
         """)
@@ -1,6 +1,7 @@
 package openapi3_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
@@ -41,3 +42,151 @@ func TestParsingDiscriminator(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 2, len(loader.Components.Schemas["MyResponseType"].Value.OneOf))
 }
+
+var jsonSpecWithServiceConfigurations = []byte(`
+{
+	"openapi": "3.0.0",
+	"components": {
+		"schemas": {
+			"ServiceConfiguration": {
+				"discriminator": {
+					"propertyName": "type",
+					"mapping": {
+						"wmts": "#/components/schemas/WMTS",
+						"xyz": "XYZ"
+					}
+				},
+				"oneOf": [
+					{"$ref": "#/components/schemas/WMTS"},
+					{"$ref": "#/components/schemas/XYZ"}
+				]
+			},
+			"ImplicitConfiguration": {
+				"discriminator": {"propertyName": "type"},
+				"anyOf": [
+					{"$ref": "#/components/schemas/WMTS"},
+					{"$ref": "#/components/schemas/XYZ"}
+				]
+			},
+			"Configuration": {
+				"oneOf": [
+					{"$ref": "#/components/schemas/WMTS"},
+					{"$ref": "#/components/schemas/XYZ"}
+				]
+			},
+			"Overlapping": {
+				"oneOf": [
+					{"type": "number"},
+					{"type": "number", "minimum": 0}
+				]
+			},
+			"WMTS": {
+				"type": "object",
+				"required": ["type", "version"],
+				"properties": {
+					"type": {"type": "string"},
+					"version": {"type": "string", "enum": ["1.0.0"]}
+				}
+			},
+			"XYZ": {
+				"type": "object",
+				"required": ["type", "tile_size"],
+				"properties": {
+					"type": {"type": "string"},
+					"tile_size": {"type": "integer", "minimum": 256}
+				}
+			}
+		}
+	}
+}
+`)
+
+func TestDiscriminatorValidation(t *testing.T) {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(jsonSpecWithServiceConfigurations)
+	require.NoError(t, err)
+	schemas := swagger.Components.Schemas
+
+	tests := []struct {
+		Title       string
+		Schema      string
+		Value       map[string]interface{}
+		SchemaField string
+		Pointer     []string
+		Reason      string
+	}{
+		{
+			Title:       "mapped reference",
+			Schema:      "ServiceConfiguration",
+			Value:       map[string]interface{}{"type": "wmts", "version": "2.0.0"},
+			SchemaField: "enum",
+			Pointer:     []string{"version"},
+			Reason:      `Doesn't match schema "#/components/schemas/WMTS" of "oneOf" selected by the discriminator property 'type'`,
+		},
+		{
+			Title:       "mapped schema name",
+			Schema:      "ServiceConfiguration",
+			Value:       map[string]interface{}{"type": "xyz", "tile_size": 128},
+			SchemaField: "minimum",
+			Pointer:     []string{"tile_size"},
+			Reason:      `Doesn't match schema "#/components/schemas/XYZ" of "oneOf" selected by the discriminator property 'type'`,
+		},
+		{
+			Title:       "implicit mapping",
+			Schema:      "ImplicitConfiguration",
+			Value:       map[string]interface{}{"type": "XYZ"},
+			SchemaField: "required",
+			Pointer:     []string{"tile_size"},
+			Reason:      `Doesn't match schema "#/components/schemas/XYZ" of "anyOf" selected by the discriminator property 'type'`,
+		},
+		{
+			Title:       "missing property",
+			Schema:      "ServiceConfiguration",
+			Value:       map[string]interface{}{"version": "1.0.0"},
+			SchemaField: "discriminator",
+			Pointer:     []string{"type"},
+			Reason:      "Property 'type' of the discriminator is missing",
+		},
+		{
+			Title:       "unknown value",
+			Schema:      "ServiceConfiguration",
+			Value:       map[string]interface{}{"type": "wms", "version": "1.0.0"},
+			SchemaField: "discriminator",
+			Pointer:     []string{"type"},
+			Reason:      `Value 'wms' of the discriminator property 'type' doesn't select any schema of "oneOf"`,
+		},
+		{
+			Title:       "closest branch",
+			Schema:      "Configuration",
+			Value:       map[string]interface{}{"type": "xyz", "tile_size": 128},
+			SchemaField: "minimum",
+			Pointer:     []string{"tile_size"},
+			Reason:      `Doesn't match any schema of "oneOf", closest is "#/components/schemas/XYZ"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Title, func(t *testing.T) {
+			err := validateSchema(t, schemas[test.Schema].Value, test.Value)
+			require.Error(t, err)
+			schemaErr, ok := err.(*openapi3.SchemaError)
+			require.True(t, ok)
+			require.Equal(t, test.SchemaField, schemaErr.SchemaField)
+			require.Equal(t, test.Pointer, schemaErr.JSONPointer())
+			require.True(t, strings.HasPrefix(schemaErr.Reason, test.Reason), schemaErr.Reason)
+		})
+	}
+
+	require.NoError(t, validateSchema(t, schemas["ServiceConfiguration"].Value, map[string]interface{}{"type": "xyz", "tile_size": 512}))
+	require.NoError(t, validateSchema(t, schemas["ImplicitConfiguration"].Value, map[string]interface{}{"type": "WMTS", "version": "1.0.0"}))
+	require.NoError(t, validateSchema(t, schemas["Configuration"].Value, map[string]interface{}{"type": "wmts", "version": "1.0.0"}))
+}
+
+func TestOneOfMatchingSeveralSchemas(t *testing.T) {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(jsonSpecWithServiceConfigurations)
+	require.NoError(t, err)
+
+	err = validateSchema(t, swagger.Components.Schemas["Overlapping"].Value, 1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `Matches more than one schema of "oneOf": "oneOf/0", "oneOf/1"`)
+	require.NoError(t, validateSchema(t, swagger.Components.Schemas["Overlapping"].Value, -1))
+}
@@ -0,0 +1,199 @@
+package openapi3_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const specOpenAPI31 = `
+openapi: 3.1.0
+info:
+  title: 'test'
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    NullableString:
+      type: [string, "null"]
+    StringOrNumber:
+      type: [string, number]
+    Any: {}
+    Const:
+      const: openEO
+    Exclusive:
+      type: number
+      exclusiveMinimum: 0
+      exclusiveMaximum: 10
+    Tuple:
+      type: array
+      prefixItems:
+        - type: string
+        - type: number
+      items: false
+    Link:
+      type: object
+      required: [href]
+      properties:
+        href:
+          type: string
+    Process:
+      $ref: '#/components/schemas/Link'
+      required: [rel]
+      description: Link with a relation
+    Closed:
+      allOf:
+        - $ref: '#/components/schemas/Link'
+      properties:
+        rel:
+          type: string
+      unevaluatedProperties: false
+    Conditional:
+      type: object
+      if:
+        properties:
+          type:
+            const: Feature
+      then:
+        required: [geometry]
+      else:
+        required: [features]
+    WithDefs:
+      $defs:
+        id:
+          type: string
+          pattern: '^[a-z]+$'
+      type: object
+      properties:
+        id:
+          $ref: '#/components/schemas/WithDefs/$defs/id'
+`
+
+const specOpenAPI30 = `
+openapi: 3.0.3
+info:
+  title: 'test'
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Any: {}
+    Link:
+      type: object
+      required: [href]
+      properties:
+        href:
+          type: string
+    Process:
+      $ref: '#/components/schemas/Link'
+      required: [rel]
+`
+
+func loadSpecSchemas(t *testing.T, spec string) map[string]*openapi3.SchemaRef {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(spec))
+	require.NoError(t, err)
+	require.NoError(t, swagger.Validate(context.Background()))
+	return swagger.Components.Schemas
+}
+
+func TestOpenAPI31Schemas(t *testing.T) {
+	schemas := loadSpecSchemas(t, specOpenAPI31)
+
+	tests := []struct {
+		Schema     string
+		AllValid   []interface{}
+		AllInvalid []interface{}
+	}{
+		{"NullableString", []interface{}{"a", nil}, []interface{}{1, true}},
+		{"StringOrNumber", []interface{}{"a", 1.5}, []interface{}{nil, true, []interface{}{}}},
+		{"Any", []interface{}{nil, "a", 1, map[string]interface{}{}}, nil},
+		{"Const", []interface{}{"openEO"}, []interface{}{"openeo", nil}},
+		{"Exclusive", []interface{}{0.1, 9.9}, []interface{}{0, 10, -1}},
+		{"Tuple", []interface{}{[]interface{}{"a", 1}, []interface{}{"a"}}, []interface{}{[]interface{}{1, "a"}, []interface{}{"a", 1, 2}}},
+		{"Process",
+			[]interface{}{map[string]interface{}{"href": "https://openeo.org", "rel": "self"}},
+			[]interface{}{map[string]interface{}{"href": "https://openeo.org"}, map[string]interface{}{"rel": "self"}}},
+		{"Closed",
+			[]interface{}{map[string]interface{}{"href": "https://openeo.org", "rel": "self"}},
+			[]interface{}{map[string]interface{}{"href": "https://openeo.org", "title": "openEO"}}},
+		{"Conditional",
+			[]interface{}{map[string]interface{}{"type": "Feature", "geometry": nil}, map[string]interface{}{"type": "FeatureCollection", "features": []interface{}{}}},
+			[]interface{}{map[string]interface{}{"type": "Feature"}, map[string]interface{}{"type": "FeatureCollection", "geometry": nil}}},
+		{"WithDefs", []interface{}{map[string]interface{}{"id": "abc"}}, []interface{}{map[string]interface{}{"id": "ABC"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Schema, func(t *testing.T) {
+			schema := schemas[test.Schema].Value
+			require.NotNil(t, schema)
+			require.True(t, schema.JSONSchema2020)
+			for _, value := range test.AllValid {
+				require.NoError(t, validateSchema(t, schema, value))
+			}
+			for _, value := range test.AllInvalid {
+				require.Error(t, validateSchema(t, schema, value))
+			}
+		})
+	}
+}
+
+func TestOpenAPI31UnevaluatedPropertiesError(t *testing.T) {
+	schemas := loadSpecSchemas(t, specOpenAPI31)
+
+	err := validateSchema(t, schemas["Closed"].Value, map[string]interface{}{"href": "https://openeo.org", "title": "openEO"})
+	require.Error(t, err)
+	schemaErr, ok := err.(*openapi3.SchemaError)
+	require.True(t, ok)
+	require.Equal(t, "unevaluatedProperties", schemaErr.SchemaField)
+	require.Equal(t, []string{"title"}, schemaErr.JSONPointer())
+}
+
+func TestOpenAPI30RefSiblingsIgnored(t *testing.T) {
+	schemas := loadSpecSchemas(t, specOpenAPI30)
+
+	// Keywords next to $ref and null without nullable follow OpenAPI 3.0
+	require.False(t, schemas["Process"].Value.JSONSchema2020)
+	require.NoError(t, validateSchema(t, schemas["Process"].Value, map[string]interface{}{"href": "https://openeo.org"}))
+	require.Error(t, validateSchema(t, schemas["Any"].Value, nil))
+}
+
+func TestOpenAPI31Marshal(t *testing.T) {
+	schemas := loadSpecSchemas(t, specOpenAPI31)
+
+	data, err := json.Marshal(schemas["NullableString"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":["string","null"]}`, string(data))
+
+	data, err = json.Marshal(schemas["Exclusive"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":10}`, string(data))
+
+	data, err = json.Marshal(schemas["Process"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"$ref":"#/components/schemas/Link","required":["rel"],"description":"Link with a relation"}`, string(data))
+}
+
+func TestOpenAPI31Unmarshal(t *testing.T) {
+	var schema openapi3.Schema
+	err := json.Unmarshal([]byte(`{"type":["integer","null"],"exclusiveMinimum":1,"additionalProperties":false}`), &schema)
+	require.NoError(t, err)
+	require.Equal(t, "integer", schema.Type)
+	require.True(t, schema.Nullable)
+	require.Nil(t, schema.Types)
+	require.Equal(t, 1.0, *schema.ExclusiveMinValue)
+	require.False(t, schema.ExclusiveMin)
+	require.False(t, *schema.AdditionalPropertiesAllowed)
+	require.Nil(t, schema.AdditionalProperties)
+
+	var object openapi3.Schema
+	err = json.Unmarshal([]byte(`{"type":"object","properties":{"a":true,"b":false}}`), &object)
+	require.NoError(t, err)
+	require.NoError(t, object.VisitJSON(map[string]interface{}{"a": 1.0}))
+	err = object.VisitJSON(map[string]interface{}{"b": 1.0})
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), `Error at "/b"`))
+}
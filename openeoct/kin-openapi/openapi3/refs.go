@@ -1,7 +1,11 @@
 package openapi3
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
 
 	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/jsoninfo"
 )
@@ -152,6 +156,8 @@ func (value *RequestBodyRef) Validate(c context.Context) error {
 type SchemaRef struct {
 	Ref   string
 	Value *Schema
+	// Keywords next to Ref, which apply in addition to the referenced schema in OpenAPI 3.1
+	siblings *Schema
 }
 
 func NewSchemaRef(ref string, value *Schema) *SchemaRef {
@@ -162,11 +168,51 @@ func NewSchemaRef(ref string, value *Schema) *SchemaRef {
 }
 
 func (value *SchemaRef) MarshalJSON() ([]byte, error) {
+	if value.Ref != "" && value.siblings != nil {
+		data, err := json.Marshal(value.siblings)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		fields["$ref"], _ = json.Marshal(value.Ref)
+		return json.Marshal(fields)
+	}
 	return jsoninfo.MarshalRef(value.Ref, value.Value)
 }
 
 func (value *SchemaRef) UnmarshalJSON(data []byte) error {
-	return jsoninfo.UnmarshalRef(data, &value.Ref, &value.Value)
+	// Boolean schemas of JSON Schema 2020-12
+	if allowed, err := strconv.ParseBool(string(bytes.TrimSpace(data))); err == nil {
+		value.Value = newBooleanSchema(allowed)
+		return nil
+	}
+
+	if err := jsoninfo.UnmarshalRef(data, &value.Ref, &value.Value); err != nil || value.Ref == "" {
+		return err
+	}
+
+	// Keywords next to $ref are ignored in OpenAPI 3.0, they are kept for OpenAPI 3.1
+	// unless they are annotations only
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	delete(fields, "$ref")
+	keywords := false
+	for name := range fields {
+		if !schemaAnnotations[name] && !strings.HasPrefix(name, "x-") {
+			keywords = true
+		}
+	}
+	if keywords {
+		siblings, _ := json.Marshal(fields)
+		value.siblings = &Schema{}
+		return json.Unmarshal(siblings, value.siblings)
+	}
+	return nil
 }
 
 func (value *SchemaRef) Validate(c context.Context) error {
@@ -9,7 +9,9 @@ import (
 	"math"
 	"math/big"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode/utf16"
 
 	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/jsoninfo"
@@ -49,6 +51,7 @@ func Uint64Ptr(value uint64) *uint64 {
 }
 
 // Schema is specified by OpenAPI/Swagger 3.0 standard.
+// The JSON Schema 2020-12 keywords of OpenAPI 3.1 are supported as well.
 type Schema struct {
 	ExtensionProps
 
@@ -56,7 +59,7 @@ type Schema struct {
 	AnyOf        []*SchemaRef  `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
 	AllOf        []*SchemaRef  `json:"allOf,omitempty" yaml:"allOf,omitempty"`
 	Not          *SchemaRef    `json:"not,omitempty" yaml:"not,omitempty"`
-	Type         string        `json:"type,omitempty" yaml:"type,omitempty"`
+	Type         string        `json:"-" multijson:"type,omitempty" yaml:"type,omitempty"`
 	Title        string        `json:"title,omitempty" yaml:"title,omitempty"`
 	Format       string        `json:"format,omitempty" yaml:"format,omitempty"`
 	Description  string        `json:"description,omitempty" yaml:"description,omitempty"`
@@ -70,8 +73,8 @@ type Schema struct {
 	// Array-related, here for struct compactness
 	UniqueItems bool `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
 	// Number-related, here for struct compactness
-	ExclusiveMin bool `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
-	ExclusiveMax bool `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	ExclusiveMin bool `json:"-" multijson:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMax bool `json:"-" multijson:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
 	// Properties
 	Nullable  bool        `json:"nullable,omitempty" yaml:"nullable,omitempty"`
 	ReadOnly  bool        `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
@@ -101,18 +104,107 @@ type Schema struct {
 	MaxProps             *uint64               `json:"maxProperties,omitempty" yaml:"maxProperties,omitempty"`
 	AdditionalProperties *SchemaRef            `json:"-" multijson:"additionalProperties,omitempty" yaml:"-"`
 	Discriminator        *Discriminator        `json:"discriminator,omitempty" yaml:"discriminator,omitempty"`
+
+	// JSON Schema 2020-12, used by OpenAPI 3.1
+
+	// Types is set instead of Type for type arrays with more than one type besides "null".
+	// A single type and "null" (e.g. ["string", "null"]) is read as nullable Type.
+	Types                 []string              `json:"-" multijson:"type,omitempty" yaml:"-"`
+	Const                 interface{}           `json:"const,omitempty" yaml:"const,omitempty"`
+	Examples              []interface{}         `json:"examples,omitempty" yaml:"examples,omitempty"`
+	ExclusiveMinValue     *float64              `json:"-" multijson:"exclusiveMinimum,omitempty" yaml:"-"`
+	ExclusiveMaxValue     *float64              `json:"-" multijson:"exclusiveMaximum,omitempty" yaml:"-"`
+	PrefixItems           []*SchemaRef          `json:"prefixItems,omitempty" yaml:"prefixItems,omitempty"`
+	UnevaluatedProperties *SchemaRef            `json:"unevaluatedProperties,omitempty" yaml:"unevaluatedProperties,omitempty"`
+	If                    *SchemaRef            `json:"if,omitempty" yaml:"if,omitempty"`
+	Then                  *SchemaRef            `json:"then,omitempty" yaml:"then,omitempty"`
+	Else                  *SchemaRef            `json:"else,omitempty" yaml:"else,omitempty"`
+	Defs                  map[string]*SchemaRef `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+
+	// JSONSchema2020 selects the validation rules of JSON Schema 2020-12 instead of the ones of OpenAPI 3.0,
+	// e.g. schemas without type accept null. It is set by the SwaggerLoader for OpenAPI 3.1 documents.
+	JSONSchema2020 bool `json:"-" yaml:"-"`
+}
+
+// Keywords of schemas that do not affect the validation
+var schemaAnnotations = map[string]bool{
+	"$comment":     true,
+	"default":      true,
+	"deprecated":   true,
+	"description":  true,
+	"example":      true,
+	"examples":     true,
+	"externalDocs": true,
+	"summary":      true,
+	"title":        true,
+	"xml":          true,
 }
 
 func NewSchema() *Schema {
 	return &Schema{}
 }
 
+// newBooleanSchema returns the schema equivalent to the boolean schema true or false of JSON Schema 2020-12
+func newBooleanSchema(allowed bool) *Schema {
+	if allowed {
+		return &Schema{JSONSchema2020: true}
+	}
+	return &Schema{
+		Not:            &SchemaRef{Value: &Schema{JSONSchema2020: true}},
+		JSONSchema2020: true,
+	}
+}
+
 func (schema *Schema) MarshalJSON() ([]byte, error) {
+	if schema.JSONSchema2020 && schema.Nullable {
+		// Nullable is not a keyword of JSON Schema 2020-12
+		value := *schema
+		value.Nullable = false
+		if schema.Type != "" && schema.Type != "null" {
+			value.Types = []string{schema.Type, "null"}
+			value.Type = ""
+		}
+		return jsoninfo.MarshalStrictStruct(&value)
+	}
 	return jsoninfo.MarshalStrictStruct(schema)
 }
 
 func (schema *Schema) UnmarshalJSON(data []byte) error {
-	return jsoninfo.UnmarshalStrictStruct(data, schema)
+	if err := jsoninfo.UnmarshalStrictStruct(data, schema); err != nil {
+		return err
+	}
+
+	// Boolean schemas of additionalProperties are kept in AdditionalPropertiesAllowed
+	var additional struct {
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &additional); err == nil {
+		if allowed, err := strconv.ParseBool(string(additional.AdditionalProperties)); err == nil {
+			schema.AdditionalProperties = nil
+			schema.AdditionalPropertiesAllowed = &allowed
+		}
+	}
+
+	// Type arrays with a single type besides "null" are read as nullable type
+	if len(schema.Types) > 0 {
+		var types []string
+		for _, typ := range schema.Types {
+			if typ == "null" {
+				schema.Nullable = true
+			} else {
+				types = append(types, typ)
+			}
+		}
+		switch len(types) {
+		case 0:
+			schema.Type = "null"
+			schema.Types = nil
+		case 1:
+			schema.Type = types[0]
+			schema.Types = nil
+		}
+	}
+	return nil
 }
 
 func (schema *Schema) NewRef() *SchemaRef {
@@ -395,15 +487,19 @@ func (schema *Schema) WithAdditionalProperties(v *Schema) *Schema {
 func (schema *Schema) IsEmpty() bool {
 	if schema.Type != "" || schema.Format != "" || len(schema.Enum) != 0 ||
 		schema.UniqueItems || schema.ExclusiveMin || schema.ExclusiveMax ||
-		!schema.Nullable ||
+		(!schema.Nullable && !schema.JSONSchema2020) ||
 		schema.Min != nil || schema.Max != nil || schema.MultipleOf != nil ||
 		schema.MinLength != 0 || schema.MaxLength != nil || schema.Pattern != "" ||
 		schema.MinItems != 0 || schema.MaxItems != nil ||
 		len(schema.Required) != 0 ||
-		schema.MinProps != 0 || schema.MaxProps != nil {
+		schema.MinProps != 0 || schema.MaxProps != nil ||
+		len(schema.Types) != 0 || schema.Const != nil ||
+		schema.ExclusiveMinValue != nil || schema.ExclusiveMaxValue != nil ||
+		len(schema.PrefixItems) != 0 || schema.If != nil {
 		return false
 	}
-	if n := schema.Not; n != nil && !n.Value.IsEmpty() {
+	// The boolean schema false is "not: {}" in JSON Schema 2020-12
+	if n := schema.Not; n != nil && (!n.Value.IsEmpty() || n.Value.JSONSchema2020) {
 		return false
 	}
 	if ap := schema.AdditionalProperties; ap != nil && !ap.Value.IsEmpty() {
@@ -415,6 +511,9 @@ func (schema *Schema) IsEmpty() bool {
 	if items := schema.Items; items != nil && !items.Value.IsEmpty() {
 		return false
 	}
+	if up := schema.UnevaluatedProperties; up != nil && !up.Value.IsEmpty() {
+		return false
+	}
 	for _, s := range schema.Properties {
 		if !s.Value.IsEmpty() {
 			return false
@@ -490,9 +589,28 @@ func (schema *Schema) validate(c context.Context, stack []*Schema) (err error) {
 		}
 	}
 
+	for _, typ := range schema.Types {
+		switch typ {
+		case "null", "boolean", "number", "integer", "string", "array", "object":
+		default:
+			return fmt.Errorf("Unsupported 'type' value '%s'", typ)
+		}
+	}
+
+	for _, ref := range schema.subSchemas2020() {
+		v := ref.Value
+		if v == nil {
+			return foundUnresolvedRef(ref.Ref)
+		}
+		if err = v.validate(c, stack); err != nil {
+			return
+		}
+	}
+
 	schemaType := schema.Type
 	switch schemaType {
 	case "":
+	case "null":
 	case "boolean":
 	case "number":
 		if format := schema.Format; len(format) > 0 {
@@ -516,26 +634,15 @@ func (schema *Schema) validate(c context.Context, stack []*Schema) (err error) {
 		}
 	case "string":
 		if format := schema.Format; len(format) > 0 {
-			switch format {
-			// Supported by OpenAPIv3.0.1:
-			case "byte", "binary", "date", "date-time", "password":
-				// In JSON Draft-07 (not validated yet though):
-			case "regex":
-			case "time", "email", "idn-email":
-			case "hostname", "idn-hostname", "ipv4", "ipv6":
-			// Added for openeoct:
-			case "commonmark":
-			case "uri", "uri-reference", "iri", "iri-reference", "uri-template":
-			case "json-pointer", "relative-json-pointer":
-			default:
-				// Try to check for custom defined formats
-				if _, ok := SchemaStringFormats[format]; !ok && !SchemaFormatValidationDisabled {
-					return unsupportedFormat(format)
-				}
+			// Unknown formats only annotate strings, unless they are handled strictly
+			_, ok := SchemaStringFormats[format]
+			if !ok && !SchemaFormatValidationDisabled && formatModeOf(c) == FormatStrict {
+				return unsupportedFormat(format)
 			}
 		}
 	case "array":
-		if schema.Items == nil {
+		// Arrays without items are allowed by JSON Schema 2020-12
+		if schema.Items == nil && !schema.JSONSchema2020 && len(schema.PrefixItems) == 0 {
 			return errors.New("When schema type is 'array', schema 'items' must be non-null")
 		}
 	case "object":
@@ -576,38 +683,63 @@ func (schema *Schema) validate(c context.Context, stack []*Schema) (err error) {
 	return
 }
 
+// subSchemas2020 returns the schemas of the JSON Schema 2020-12 keywords
+func (schema *Schema) subSchemas2020() []*SchemaRef {
+	refs := append([]*SchemaRef{}, schema.PrefixItems...)
+	for _, ref := range []*SchemaRef{schema.UnevaluatedProperties, schema.If, schema.Then, schema.Else} {
+		if ref != nil {
+			refs = append(refs, ref)
+		}
+	}
+	names := make([]string, 0, len(schema.Defs))
+	for name := range schema.Defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		refs = append(refs, schema.Defs[name])
+	}
+	return refs
+}
+
 func (schema *Schema) IsMatching(value interface{}) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
 func (schema *Schema) IsMatchingJSONBoolean(value bool) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
 func (schema *Schema) IsMatchingJSONNumber(value float64) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
 func (schema *Schema) IsMatchingJSONString(value string) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
 func (schema *Schema) IsMatchingJSONArray(value []interface{}) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
 func (schema *Schema) IsMatchingJSONObject(value map[string]interface{}) bool {
-	return schema.visitJSON(value, true) == nil
+	return schema.visitJSON(value, newSchemaValidationSettings(failFast())) == nil
 }
 
-func (schema *Schema) VisitJSON(value interface{}) error {
-	return schema.visitJSON(value, false)
+// VisitJSON validates the value against the schema. By default the value is validated regardless
+// of readOnly and writeOnly, see VisitAsRequest and VisitAsResponse.
+func (schema *Schema) VisitJSON(value interface{}, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSON(value, settings)
 }
 
-func (schema *Schema) visitJSON(value interface{}, fast bool) (err error) {
+func (schema *Schema) visitJSON(value interface{}, settings *schemaValidationSettings) (err error) {
 	switch value := value.(type) {
 	case nil:
-		return schema.visitJSONNull(fast)
+		// Null is validated like any other value by JSON Schema 2020-12, e.g. against enum and const
+		if !schema.JSONSchema2020 {
+			return schema.visitJSONNull(settings)
+		}
 	case float64:
 		if math.IsNaN(value) {
 			return ErrSchemaInputNaN
@@ -620,23 +752,23 @@ func (schema *Schema) visitJSON(value interface{}, fast bool) (err error) {
 	if schema.IsEmpty() {
 		return
 	}
-	if err = schema.visitSetOperations(value, fast); err != nil {
+	if err = schema.visitSetOperations(value, settings); err != nil {
 		return
 	}
 
 	switch value := value.(type) {
 	case nil:
-		return schema.visitJSONNull(fast)
+		return schema.visitJSONNull(settings)
 	case bool:
-		return schema.visitJSONBoolean(value, fast)
+		return schema.visitJSONBoolean(value, settings)
 	case float64:
-		return schema.visitJSONNumber(value, fast)
+		return schema.visitJSONNumber(value, settings)
 	case string:
-		return schema.visitJSONString(value, fast)
+		return schema.visitJSONString(value, settings)
 	case []interface{}:
-		return schema.visitJSONArray(value, fast)
+		return schema.visitJSONArray(value, settings)
 	case map[string]interface{}:
-		return schema.visitJSONObject(value, fast)
+		return schema.visitJSONObject(value, settings)
 	default:
 		return &SchemaError{
 			Value:       value,
@@ -647,14 +779,14 @@ func (schema *Schema) visitJSON(value interface{}, fast bool) (err error) {
 	}
 }
 
-func (schema *Schema) visitSetOperations(value interface{}, fast bool) (err error) {
+func (schema *Schema) visitSetOperations(value interface{}, settings *schemaValidationSettings) (err error) {
 	if enum := schema.Enum; len(enum) != 0 {
 		for _, v := range enum {
 			if value == v {
 				return
 			}
 		}
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -665,13 +797,25 @@ func (schema *Schema) visitSetOperations(value interface{}, fast bool) (err erro
 		}
 	}
 
+	if v := schema.Const; v != nil && !isJSONEqual(value, v) {
+		if settings.failfast {
+			return errSchema
+		}
+		return &SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "const",
+			Reason:      "JSON value is not the constant value",
+		}
+	}
+
 	if ref := schema.Not; ref != nil {
 		v := ref.Value
 		if v == nil {
 			return foundUnresolvedRef(ref.Ref)
 		}
-		if err := v.visitJSON(value, true); err == nil {
-			if fast {
+		if err := v.visitJSON(value, settings.fast()); err == nil {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -683,48 +827,65 @@ func (schema *Schema) visitSetOperations(value interface{}, fast bool) (err erro
 	}
 
 	if v := schema.OneOf; len(v) > 0 {
-		ok := 0
-		for _, item := range v {
-			v := item.Value
-			if v == nil {
-				return foundUnresolvedRef(item.Ref)
-			}
-			if err := v.visitJSON(value, true); err == nil {
-				ok++
+		if selected, err := schema.visitDiscriminatedBranch(value, "oneOf", v, settings); err != nil {
+			return err
+		} else if !selected {
+			var matched []string
+			var match *Schema
+			for i, item := range v {
+				v := item.Value
+				if v == nil {
+					return foundUnresolvedRef(item.Ref)
+				}
+				if err := v.visitJSON(value, settings.fast()); err == nil {
+					matched = append(matched, branchName("oneOf", i, item))
+					match = v
+				}
 			}
-		}
-		if ok != 1 {
-			if fast {
-				return errSchema
+			if len(matched) == 1 && settings.warns() {
+				// Branches are tried without reporting, the warnings of the matching branch are reported now
+				match.visitJSON(value, settings)
 			}
-			return &SchemaError{
-				Value:       value,
-				Schema:      schema,
-				SchemaField: "oneOf",
+			if len(matched) != 1 {
+				if settings.failfast {
+					return errSchema
+				}
+				if len(matched) == 0 {
+					return closestBranchError(value, "oneOf", v, settings)
+				}
+				return &SchemaError{
+					Value:       value,
+					Schema:      schema,
+					SchemaField: "oneOf",
+					Reason:      fmt.Sprintf("Matches more than one schema of \"oneOf\": %s", strings.Join(matched, ", ")),
+				}
 			}
 		}
 	}
 
 	if v := schema.AnyOf; len(v) > 0 {
-		ok := false
-		for _, item := range v {
-			v := item.Value
-			if v == nil {
-				return foundUnresolvedRef(item.Ref)
-			}
-			if err := v.visitJSON(value, true); err == nil {
-				ok = true
-				break
-			}
-		}
-		if !ok {
-			if fast {
-				return errSchema
+		if selected, err := schema.visitDiscriminatedBranch(value, "anyOf", v, settings); err != nil {
+			return err
+		} else if !selected {
+			ok := false
+			for _, item := range v {
+				v := item.Value
+				if v == nil {
+					return foundUnresolvedRef(item.Ref)
+				}
+				if err := v.visitJSON(value, settings.fast()); err == nil {
+					ok = true
+					if settings.warns() {
+						v.visitJSON(value, settings)
+					}
+					break
+				}
 			}
-			return &SchemaError{
-				Value:       value,
-				Schema:      schema,
-				SchemaField: "anyOf",
+			if !ok {
+				if settings.failfast {
+					return errSchema
+				}
+				return closestBranchError(value, "anyOf", v, settings)
 			}
 		}
 	}
@@ -734,8 +895,8 @@ func (schema *Schema) visitSetOperations(value interface{}, fast bool) (err erro
 		if v == nil {
 			return foundUnresolvedRef(item.Ref)
 		}
-		if err := v.visitJSON(value, false); err != nil {
-			if fast {
+		if err := v.visitJSON(value, settings.detailed()); err != nil {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -746,14 +907,207 @@ func (schema *Schema) visitSetOperations(value interface{}, fast bool) (err erro
 			}
 		}
 	}
+
+	if ref := schema.If; ref != nil {
+		v := ref.Value
+		if v == nil {
+			return foundUnresolvedRef(ref.Ref)
+		}
+		branch, field := schema.Else, "else"
+		if v.visitJSON(value, settings.fast()) == nil {
+			branch, field = schema.Then, "then"
+		}
+		if branch != nil {
+			if branch.Value == nil {
+				return foundUnresolvedRef(branch.Ref)
+			}
+			if err := branch.Value.visitJSON(value, settings.detailed()); err != nil {
+				if settings.failfast {
+					return errSchema
+				}
+				return &SchemaError{
+					Value:       value,
+					Schema:      schema,
+					SchemaField: field,
+					Origin:      err,
+				}
+			}
+		}
+	}
 	return
 }
 
-func (schema *Schema) visitJSONNull(fast bool) (err error) {
-	if schema.Nullable {
+// visitDiscriminatedBranch validates the value against the branch of "oneOf" or "anyOf" selected
+// by the value of the discriminator property. Returns false if the schema has no
+// discriminator or the value is no object, so that all branches need to be tried.
+func (schema *Schema) visitDiscriminatedBranch(value interface{}, field string, branches []*SchemaRef, settings *schemaValidationSettings) (bool, error) {
+	discriminator := schema.Discriminator
+	object, ok := value.(map[string]interface{})
+	if discriminator == nil || discriminator.PropertyName == "" || !ok {
+		return false, nil
+	}
+
+	name := discriminator.PropertyName
+	property, ok := object[name].(string)
+	if !ok {
+		if settings.failfast {
+			return false, errSchema
+		}
+		reason := fmt.Sprintf("Property '%s' of the discriminator is missing", name)
+		if _, exists := object[name]; exists {
+			reason = fmt.Sprintf("Property '%s' of the discriminator is not a string", name)
+		}
+		return false, markSchemaErrorKey(&SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "discriminator",
+			Reason:      reason,
+		}, name)
+	}
+
+	var branch *SchemaRef
+	i := -1
+	for j, item := range branches {
+		if discriminatorSelects(discriminator, property, item.Ref) {
+			branch, i = item, j
+			break
+		}
+	}
+	if branch == nil {
+		if settings.failfast {
+			return false, errSchema
+		}
+		return false, markSchemaErrorKey(&SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "discriminator",
+			Reason:      fmt.Sprintf("Value '%s' of the discriminator property '%s' doesn't select any schema of %q", property, name, field),
+		}, name)
+	}
+	if branch.Value == nil {
+		return false, foundUnresolvedRef(branch.Ref)
+	}
+
+	if err := branch.Value.visitJSON(value, settings); err != nil {
+		if settings.failfast {
+			return false, errSchema
+		}
+		return false, branchError(err, value, fmt.Sprintf(
+			"Doesn't match schema %s of %q selected by the discriminator property '%s'",
+			branchName(field, i, branch), field, name))
+	}
+	return true, nil
+}
+
+// discriminatorSelects tells whether the value of the discriminator property selects the referenced schema,
+// either by the mapping or else by the name of the schema. Mapped values may be references or schema names.
+func discriminatorSelects(discriminator *Discriminator, value string, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	if mapped, ok := discriminator.Mapping[value]; ok {
+		return mapped == ref || mapped == name
+	}
+	return name == value
+}
+
+// closestBranchError returns the error of the branch of "oneOf" or "anyOf" which is the closest match
+// for the value: the branch failing deepest inside the value, or else the branch knowing most of its properties.
+func closestBranchError(value interface{}, field string, branches []*SchemaRef, settings *schemaValidationSettings) error {
+	var closest error
+	closestName := ""
+	closestDepth, closestKnown := -1, -1
+	for i, item := range branches {
+		// Mismatching branches are not reported as warnings
+		err := item.Value.visitJSON(value, settings.silenced())
+		if err == nil {
+			continue
+		}
+		depth, known := errorDepth(err), knownProperties(item.Value, value)
+		if depth > closestDepth || (depth == closestDepth && known > closestKnown) {
+			closest, closestName = err, branchName(field, i, item)
+			closestDepth, closestKnown = depth, known
+		}
+	}
+	return branchError(closest, value, fmt.Sprintf("Doesn't match any schema of %q, closest is %s", field, closestName))
+}
+
+// branchError prefixes the reason of the error of a branch with the given context. The error keeps
+// pointing to the violation inside the branch. Errors without reason are wrapped in a SchemaError.
+func branchError(err error, value interface{}, context string) error {
+	schemaErr, ok := err.(*SchemaError)
+	for ok && schemaErr.Origin != nil {
+		origin, isSchemaErr := schemaErr.Origin.(*SchemaError)
+		if !isSchemaErr {
+			break
+		}
+		schemaErr = origin
+	}
+	if !ok || schemaErr.Origin != nil {
+		return &SchemaError{
+			Value:  value,
+			Schema: &Schema{},
+			Reason: fmt.Sprintf("%s: %v", context, err),
+		}
+	}
+
+	reason := schemaErr.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Doesn't match schema %q", schemaErr.SchemaField)
+	}
+	schemaErr.Reason = fmt.Sprintf("%s: %s", context, reason)
+	return err
+}
+
+// branchName names a branch of "oneOf" or "anyOf" by its reference or else by its index
+func branchName(field string, i int, branch *SchemaRef) string {
+	if branch.Ref != "" {
+		return fmt.Sprintf("%q", branch.Ref)
+	}
+	return fmt.Sprintf("\"%s/%d\"", field, i)
+}
+
+// errorDepth returns the number of path elements of the schema error and its origins
+func errorDepth(err error) int {
+	depth := 0
+	for {
+		schemaErr, ok := err.(*SchemaError)
+		if !ok {
+			return depth
+		}
+		depth += len(schemaErr.reversePath)
+		err = schemaErr.Origin
+	}
+}
+
+// knownProperties counts the properties of the object declared by the schema or its "allOf" schemas
+func knownProperties(schema *Schema, value interface{}) int {
+	object, ok := value.(map[string]interface{})
+	if !ok || schema == nil {
+		return 0
+	}
+	known := 0
+	for name := range object {
+		if _, ok := schema.Properties[name]; ok {
+			known++
+		}
+	}
+	for _, item := range schema.AllOf {
+		known += knownProperties(item.Value, value)
+	}
+	return known
+}
+
+func (schema *Schema) visitJSONNull(settings *schemaValidationSettings) (err error) {
+	if schema.Nullable || schema.Type == "null" || (len(schema.Types) != 0 && schema.allowsType("null")) {
+		return
+	}
+	// Schemas without type allow null in JSON Schema 2020-12
+	if schema.JSONSchema2020 && schema.Type == "" && len(schema.Types) == 0 {
 		return
 	}
-	if fast {
+	if settings.failfast {
 		return errSchema
 	}
 	return &SchemaError{
@@ -764,26 +1118,30 @@ func (schema *Schema) visitJSONNull(fast bool) (err error) {
 	}
 }
 
-func (schema *Schema) VisitJSONBoolean(value bool) error {
-	return schema.visitJSONBoolean(value, false)
+func (schema *Schema) VisitJSONBoolean(value bool, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSONBoolean(value, settings)
 }
 
-func (schema *Schema) visitJSONBoolean(value bool, fast bool) (err error) {
-	if schemaType := schema.Type; schemaType != "" && schemaType != "boolean" {
-		return schema.expectedType("boolean", fast)
+func (schema *Schema) visitJSONBoolean(value bool, settings *schemaValidationSettings) (err error) {
+	if !schema.allowsType("boolean") {
+		return schema.expectedType("boolean", settings)
 	}
 	return
 }
 
-func (schema *Schema) VisitJSONNumber(value float64) error {
-	return schema.visitJSONNumber(value, false)
+func (schema *Schema) VisitJSONNumber(value float64, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSONNumber(value, settings)
 }
 
-func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
-	schemaType := schema.Type
-	if schemaType == "integer" {
+func (schema *Schema) visitJSONNumber(value float64, settings *schemaValidationSettings) (err error) {
+	if !schema.allowsType("number") {
+		if !schema.allowsType("integer") {
+			return schema.expectedType("number, integer", settings)
+		}
 		if bigFloat := big.NewFloat(value); !bigFloat.IsInt() {
-			if fast {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -793,13 +1151,11 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 				Reason:      "Value must be an integer",
 			}
 		}
-	} else if schemaType != "" && schemaType != "number" {
-		return schema.expectedType("number, integer", fast)
 	}
 
 	// "exclusiveMinimum"
 	if v := schema.ExclusiveMin; v && !(*schema.Min < value) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -812,7 +1168,7 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 
 	// "exclusiveMaximum"
 	if v := schema.ExclusiveMax; v && !(*schema.Max > value) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -823,9 +1179,35 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 		}
 	}
 
+	// "exclusiveMinimum" of JSON Schema 2020-12
+	if v := schema.ExclusiveMinValue; v != nil && !(*v < value) {
+		if settings.failfast {
+			return errSchema
+		}
+		return &SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "exclusiveMinimum",
+			Reason:      fmt.Sprintf("Number must be more than %g", *v),
+		}
+	}
+
+	// "exclusiveMaximum" of JSON Schema 2020-12
+	if v := schema.ExclusiveMaxValue; v != nil && !(*v > value) {
+		if settings.failfast {
+			return errSchema
+		}
+		return &SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "exclusiveMaximum",
+			Reason:      fmt.Sprintf("Number must be less than %g", *v),
+		}
+	}
+
 	// "minimum"
 	if v := schema.Min; v != nil && !(*v <= value) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -838,7 +1220,7 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 
 	// "maximum"
 	if v := schema.Max; v != nil && !(*v >= value) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -854,7 +1236,7 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 		// "A numeric instance is valid only if division by this keyword's
 		//    value results in an integer."
 		if bigFloat := big.NewFloat(value / *v); !bigFloat.IsInt() {
-			if fast {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -867,13 +1249,14 @@ func (schema *Schema) visitJSONNumber(value float64, fast bool) (err error) {
 	return
 }
 
-func (schema *Schema) VisitJSONString(value string) error {
-	return schema.visitJSONString(value, false)
+func (schema *Schema) VisitJSONString(value string, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSONString(value, settings)
 }
 
-func (schema *Schema) visitJSONString(value string, fast bool) (err error) {
-	if schemaType := schema.Type; schemaType != "" && schemaType != "string" {
-		return schema.expectedType("string", fast)
+func (schema *Schema) visitJSONString(value string, settings *schemaValidationSettings) (err error) {
+	if !schema.allowsType("string") {
+		return schema.expectedType("string", settings)
 	}
 
 	// "minLength" and "maxLength"
@@ -890,7 +1273,7 @@ func (schema *Schema) visitJSONString(value string, fast bool) (err error) {
 			}
 		}
 		if minLength != 0 && length < int64(minLength) {
-			if fast {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -901,7 +1284,7 @@ func (schema *Schema) visitJSONString(value string, fast bool) (err error) {
 			}
 		}
 		if maxLength != nil && length > int64(*maxLength) {
-			if fast {
+			if settings.failfast {
 				return errSchema
 			}
 			return &SchemaError{
@@ -913,64 +1296,95 @@ func (schema *Schema) visitJSONString(value string, fast bool) (err error) {
 		}
 	}
 
-	// "format" and "pattern"
+	// "pattern"
 	cp := schema.compiledPattern
-	if cp == nil {
-		pattern := schema.Pattern
-		if v := schema.Pattern; len(v) > 0 {
-			// Pattern
-			re, err := regexp.Compile(v)
-			if err != nil {
-				return fmt.Errorf("Error while compiling regular expression '%s': %v", pattern, err)
-			}
-			cp = &compiledPattern{
-				Regexp:    re,
-				ErrReason: "JSON string doesn't match the regular expression '" + v + "'",
-			}
-			schema.compiledPattern = cp
-		} else if v := schema.Format; len(v) > 0 {
-			// No pattern, but does have a format
-			re := SchemaStringFormats[v]
-			if re != nil {
-				cp = &compiledPattern{
-					Regexp:    re,
-					ErrReason: "JSON string doesn't match the format '" + v + " (regular expression `" + re.String() + "`)'",
-				}
-				schema.compiledPattern = cp
-			}
+	if cp == nil && schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("Error while compiling regular expression '%s': %v", schema.Pattern, err)
 		}
+		cp = &compiledPattern{
+			Regexp:    re,
+			ErrReason: "JSON string doesn't match the regular expression '" + schema.Pattern + "'",
+		}
+		schema.compiledPattern = cp
 	}
-	if cp != nil {
-		if !cp.Regexp.MatchString(value) {
-			field := "format"
-			if schema.Pattern != "" {
-				field = "pattern"
-			}
-			return &SchemaError{
+	if cp != nil && !cp.Regexp.MatchString(value) {
+		if settings.failfast {
+			return errSchema
+		}
+		return &SchemaError{
+			Value:       value,
+			Schema:      schema,
+			SchemaField: "pattern",
+			Reason:      cp.ErrReason,
+		}
+	}
+
+	// "format"
+	if format := schema.Format; format != "" {
+		return schema.visitFormat(value, settings)
+	}
+	return
+}
+
+// visitFormat checks the string against the validator of its format. Depending on the mode,
+// unknown formats are ignored or rejected, and mismatches are rejected or passed to the warning handler.
+func (schema *Schema) visitFormat(value string, settings *schemaValidationSettings) error {
+	format := schema.Format
+	var reason string
+	if validator, ok := SchemaStringFormats[format]; !ok {
+		if settings.formatMode == FormatLenient {
+			return nil
+		}
+		reason = fmt.Sprintf("Format '%s' is unknown", format)
+	} else if err := validator(value); err != nil {
+		reason = fmt.Sprintf("JSON string doesn't match the format '%s': %v", format, err)
+	} else {
+		return nil
+	}
+
+	if settings.formatMode == FormatWarn {
+		if settings.warns() {
+			warning := &SchemaError{
 				Value:       value,
 				Schema:      schema,
-				SchemaField: field,
-				Reason:      cp.ErrReason,
+				SchemaField: "format",
+				Reason:      reason,
 			}
+			for i := len(settings.path) - 1; i >= 0; i-- {
+				markSchemaErrorKey(warning, settings.path[i])
+			}
+			settings.formatWarnings(warning)
 		}
+		return nil
+	}
+	if settings.failfast {
+		return errSchema
+	}
+	return &SchemaError{
+		Value:       value,
+		Schema:      schema,
+		SchemaField: "format",
+		Reason:      reason,
 	}
-	return
 }
 
-func (schema *Schema) VisitJSONArray(value []interface{}) error {
-	return schema.visitJSONArray(value, false)
+func (schema *Schema) VisitJSONArray(value []interface{}, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSONArray(value, settings)
 }
 
-func (schema *Schema) visitJSONArray(value []interface{}, fast bool) (err error) {
-	if schemaType := schema.Type; schemaType != "" && schemaType != "array" {
-		return schema.expectedType("array", fast)
+func (schema *Schema) visitJSONArray(value []interface{}, settings *schemaValidationSettings) (err error) {
+	if !schema.allowsType("array") {
+		return schema.expectedType("array", settings)
 	}
 
 	lenValue := int64(len(value))
 
 	// "minItems"
 	if v := schema.MinItems; v != 0 && lenValue < int64(v) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -983,7 +1397,7 @@ func (schema *Schema) visitJSONArray(value []interface{}, fast bool) (err error)
 
 	// "maxItems"
 	if v := schema.MaxItems; v != nil && lenValue > int64(*v) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -996,7 +1410,7 @@ func (schema *Schema) visitJSONArray(value []interface{}, fast bool) (err error)
 
 	// "uniqueItems"
 	if v := schema.UniqueItems; v && !sliceUniqueItemsChecker(value) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -1007,14 +1421,28 @@ func (schema *Schema) visitJSONArray(value []interface{}, fast bool) (err error)
 		}
 	}
 
-	// "items"
+	// "prefixItems"
+	for i, itemSchemaRef := range schema.PrefixItems {
+		if i >= len(value) {
+			break
+		}
+		itemSchema := itemSchemaRef.Value
+		if itemSchema == nil {
+			return foundUnresolvedRef(itemSchemaRef.Ref)
+		}
+		if err := itemSchema.visitJSON(value[i], settings.child(strconv.Itoa(i))); err != nil {
+			return markSchemaErrorIndex(err, i)
+		}
+	}
+
+	// "items", only the items after the prefixItems
 	if itemSchemaRef := schema.Items; itemSchemaRef != nil {
 		itemSchema := itemSchemaRef.Value
 		if itemSchema == nil {
 			return foundUnresolvedRef(itemSchemaRef.Ref)
 		}
-		for i, item := range value {
-			if err := itemSchema.VisitJSON(item); err != nil {
+		for i := len(schema.PrefixItems); i < len(value); i++ {
+			if err := itemSchema.visitJSON(value[i], settings.child(strconv.Itoa(i))); err != nil {
 				return markSchemaErrorIndex(err, i)
 			}
 		}
@@ -1022,13 +1450,14 @@ func (schema *Schema) visitJSONArray(value []interface{}, fast bool) (err error)
 	return
 }
 
-func (schema *Schema) VisitJSONObject(value map[string]interface{}) error {
-	return schema.visitJSONObject(value, false)
+func (schema *Schema) VisitJSONObject(value map[string]interface{}, opts ...SchemaValidationOption) error {
+	settings := newSchemaValidationSettings(opts...)
+	return schema.visitJSONObject(value, settings)
 }
 
-func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (err error) {
-	if schemaType := schema.Type; schemaType != "" && schemaType != "object" {
-		return schema.expectedType("object", fast)
+func (schema *Schema) visitJSONObject(value map[string]interface{}, settings *schemaValidationSettings) (err error) {
+	if !schema.allowsType("object") {
+		return schema.expectedType("object", settings)
 	}
 
 	// "properties"
@@ -1037,7 +1466,7 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 
 	// "minProperties"
 	if v := schema.MinProps; v != 0 && lenValue < int64(v) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -1050,7 +1479,7 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 
 	// "maxProperties"
 	if v := schema.MaxProps; v != nil && lenValue > int64(*v) {
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -1074,8 +1503,23 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 				if p == nil {
 					return foundUnresolvedRef(propertyRef.Ref)
 				}
-				if err := p.VisitJSON(v); err != nil {
-					if fast {
+				if settings.excludes(p) {
+					if settings.failfast {
+						return errSchema
+					}
+					field, reason := "readOnly", "read-only"
+					if settings.asrep {
+						field, reason = "writeOnly", "write-only"
+					}
+					return markSchemaErrorKey(&SchemaError{
+						Value:       value,
+						Schema:      schema,
+						SchemaField: field,
+						Reason:      fmt.Sprintf("Property '%s' is %s", k, reason),
+					}, k)
+				}
+				if err := p.visitJSON(v, settings.child(k)); err != nil {
+					if settings.failfast {
 						return errSchema
 					}
 					return markSchemaErrorKey(err, k)
@@ -1086,8 +1530,8 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 		allowed := schema.AdditionalPropertiesAllowed
 		if additionalProperties != nil || allowed == nil || (allowed != nil && *allowed) {
 			if additionalProperties != nil {
-				if err := additionalProperties.VisitJSON(v); err != nil {
-					if fast {
+				if err := additionalProperties.visitJSON(v, settings.child(k)); err != nil {
+					if settings.failfast {
 						return errSchema
 					}
 					return markSchemaErrorKey(err, k)
@@ -1095,7 +1539,7 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 			}
 			continue
 		}
-		if fast {
+		if settings.failfast {
 			return errSchema
 		}
 		return &SchemaError{
@@ -1106,8 +1550,11 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 		}
 	}
 	for _, k := range schema.Required {
+		if p := properties[k]; p != nil && p.Value != nil && settings.excludes(p.Value) {
+			continue
+		}
 		if _, ok := value[k]; !ok {
-			if fast {
+			if settings.failfast {
 				return errSchema
 			}
 			return markSchemaErrorKey(&SchemaError{
@@ -1118,21 +1565,114 @@ func (schema *Schema) visitJSONObject(value map[string]interface{}, fast bool) (
 			}, k)
 		}
 	}
+
+	// "unevaluatedProperties"
+	if ref := schema.UnevaluatedProperties; ref != nil {
+		unevaluated := ref.Value
+		if unevaluated == nil {
+			return foundUnresolvedRef(ref.Ref)
+		}
+		evaluated := make(map[string]bool, len(value))
+		schema.evaluatedProperties(value, evaluated, false, settings)
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			if !evaluated[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := unevaluated.visitJSON(value[k], settings.child(k)); err != nil {
+				if settings.failfast {
+					return errSchema
+				}
+				return markSchemaErrorKey(&SchemaError{
+					Value:       value,
+					Schema:      schema,
+					SchemaField: "unevaluatedProperties",
+					Reason:      fmt.Sprintf("Property '%s' is unsupported", k),
+				}, k)
+			}
+		}
+	}
 	return
 }
 
-func (schema *Schema) expectedType(typ string, fast bool) error {
-	if fast {
+// evaluatedProperties adds the properties of the object evaluated by the schema and its successfully
+// validated subschemas to evaluated, as defined for unevaluatedProperties by JSON Schema 2020-12.
+func (schema *Schema) evaluatedProperties(value map[string]interface{}, evaluated map[string]bool, nested bool, settings *schemaValidationSettings) {
+	allowed := schema.AdditionalPropertiesAllowed
+	for k := range value {
+		if _, ok := schema.Properties[k]; ok ||
+			schema.AdditionalProperties != nil || (allowed != nil && *allowed) ||
+			(nested && schema.UnevaluatedProperties != nil) {
+			evaluated[k] = true
+		}
+	}
+
+	for _, ref := range schema.AllOf {
+		if ref.Value != nil {
+			ref.Value.evaluatedProperties(value, evaluated, true, settings)
+		}
+	}
+	for _, refs := range [][]*SchemaRef{schema.AnyOf, schema.OneOf} {
+		for _, ref := range refs {
+			if ref.Value != nil && ref.Value.visitJSON(value, settings.fast()) == nil {
+				ref.Value.evaluatedProperties(value, evaluated, true, settings)
+			}
+		}
+	}
+	if ref := schema.If; ref != nil && ref.Value != nil {
+		branch := schema.Else
+		if ref.Value.visitJSON(value, settings.fast()) == nil {
+			ref.Value.evaluatedProperties(value, evaluated, true, settings)
+			branch = schema.Then
+		}
+		if branch != nil && branch.Value != nil {
+			branch.Value.evaluatedProperties(value, evaluated, true, settings)
+		}
+	}
+}
+
+func (schema *Schema) expectedType(typ string, settings *schemaValidationSettings) error {
+	if settings.failfast {
 		return errSchema
 	}
 	return &SchemaError{
 		Value:       typ,
 		Schema:      schema,
 		SchemaField: "type",
-		Reason:      "Field must be set to " + schema.Type + " or not be present",
+		Reason:      "Field must be set to " + schema.typeNames() + " or not be present",
 	}
 }
 
+// allowsType returns whether the type of JSON values is allowed by Type or Types
+func (schema *Schema) allowsType(typ string) bool {
+	if len(schema.Types) > 0 {
+		for _, t := range schema.Types {
+			if t == typ {
+				return true
+			}
+		}
+		return false
+	}
+	return schema.Type == "" || schema.Type == typ
+}
+
+func (schema *Schema) typeNames() string {
+	if len(schema.Types) > 0 {
+		return strings.Join(schema.Types, ", ")
+	}
+	return schema.Type
+}
+
+// isJSONEqual returns whether two JSON values are equal, numbers are compared by value
+func isJSONEqual(a interface{}, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
 type SchemaError struct {
 	Value       interface{}
 	reversePath []string
@@ -1,8 +1,16 @@
 package openapi3
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -10,29 +18,324 @@ const (
 	FormatOfStringForUUIDOfRFC4122 = `^[0-9a-f]{8}-[0-9a-f]{4}-[1-5][0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`
 )
 
-var SchemaStringFormats = make(map[string]*regexp.Regexp, 8)
+// FormatValidator checks whether a string is of a format. The error describes the mismatch.
+type FormatValidator func(value string) error
 
+// FormatValidationMode is the handling of the "format" of strings during the validation of values.
+type FormatValidationMode int
+
+const (
+	// FormatLenient rejects strings not matching a known format and ignores unknown formats. This is the default.
+	FormatLenient FormatValidationMode = iota
+	// FormatStrict rejects strings not matching their format and strings of unknown formats.
+	FormatStrict
+	// FormatWarn never rejects strings because of their format. Mismatches and unknown formats are
+	// passed to the handler set with FormatWarnings instead.
+	FormatWarn
+)
+
+type formatModeKey struct{}
+
+// ContextWithFormatMode returns a context for the validation of a specification, in which the formats
+// of strings are handled according to the mode. Only FormatStrict rejects schemas with unknown formats.
+func ContextWithFormatMode(c context.Context, mode FormatValidationMode) context.Context {
+	return context.WithValue(c, formatModeKey{}, mode)
+}
+
+// formatModeOf returns the handling of formats set with ContextWithFormatMode, FormatLenient by default.
+func formatModeOf(c context.Context) FormatValidationMode {
+	if c == nil {
+		return FormatLenient
+	}
+	mode, _ := c.Value(formatModeKey{}).(FormatValidationMode)
+	return mode
+}
+
+// SchemaStringFormats are the known formats of strings and their validators, by name.
+var SchemaStringFormats = make(map[string]FormatValidator, 32)
+
+// DefineStringFormat defines a format of strings by a regular expression.
 func DefineStringFormat(name string, pattern string) {
 	re, err := regexp.Compile(pattern)
 	if err != nil {
 		err := fmt.Errorf("Format '%v' has invalid pattern '%v': %v", name, pattern, err)
 		panic(err)
 	}
-	SchemaStringFormats[name] = re
+	DefineStringFormatValidator(name, func(value string) error {
+		if !re.MatchString(value) {
+			return fmt.Errorf("doesn't match the regular expression `%s`", re.String())
+		}
+		return nil
+	})
+}
+
+// DefineStringFormatValidator defines a format of strings by a function.
+func DefineStringFormatValidator(name string, validator FormatValidator) {
+	SchemaStringFormats[name] = validator
 }
 
 func init() {
 	// This pattern catches only some suspiciously wrong-looking email addresses.
 	// Use DefineStringFormat(...) if you need something stricter.
 	DefineStringFormat("email", `^[^@]+@[^@<>",\s]+$`)
+	DefineStringFormat("idn-email", `^[^@]+@[^@<>",\s]+$`)
 
 	// Base64
 	// The pattern supports base64 and b./ase64url. Padding ('=') is supported.
 	DefineStringFormat("byte", `(^$|^[a-zA-Z0-9+/\-_]*=*$)`)
 
-	// date
-	DefineStringFormat("date", `^[0-9]{4}-(0[0-9]|10|11|12)-([0-2][0-9]|30|31)$`)
+	// Formats which only annotate strings
+	for _, name := range []string{"binary", "password", "commonmark", "idn-hostname"} {
+		DefineStringFormatValidator(name, validateAnnotation)
+	}
+
+	// RFC 3339
+	DefineStringFormatValidator("date", validateDate)
+	DefineStringFormatValidator("date-time", validateDateTime)
+	DefineStringFormatValidator("time", validateTime)
+	// ISO 8601
+	DefineStringFormatValidator("duration", validateDuration)
+
+	DefineStringFormatValidator("hostname", validateHostname)
+	DefineStringFormatValidator("ipv4", validateIPv4)
+	DefineStringFormatValidator("ipv6", validateIPv6)
+
+	DefineStringFormatValidator("uri", validateURI)
+	DefineStringFormatValidator("iri", validateURI)
+	DefineStringFormatValidator("uri-reference", validateURIReference)
+	DefineStringFormatValidator("iri-reference", validateURIReference)
+	DefineStringFormatValidator("uri-template", validateURITemplate)
+	DefineStringFormatValidator("url", validateURL)
+	DefineStringFormat("uuid", `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	DefineStringFormatValidator("regex", validateRegex)
+	DefineStringFormat("json-pointer", `^(/([^/~]|~[01])*)*$`)
+	DefineStringFormat("relative-json-pointer", `^[0-9]+(#|(/([^/~]|~[01])*)*)$`)
+
+	// openEO and STAC
+	DefineStringFormatValidator("epsg-code", validateEPSGCode)
+	DefineStringFormatValidator("wkt2-definition", validateWKT2)
+	DefineStringFormatValidator("projjson", validatePROJJSON)
+	DefineStringFormatValidator("crs", validateCRS)
+	DefineStringFormatValidator("bbox", validateBBox)
+}
+
+func validateAnnotation(value string) error {
+	return nil
+}
+
+func validateDate(value string) error {
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return errors.New("is not a full-date of RFC 3339")
+	}
+	return nil
+}
+
+// leapSecond matches the seconds of a time, which are 60 for leap seconds
+var leapSecond = regexp.MustCompile(`^(\d{2}:\d{2}:)60`)
+
+// parseLeapSecond parses a time of RFC 3339, allowing 60 as seconds of leap seconds.
+// The prefix is the part of the value preceding the time.
+func parseLeapSecond(layout string, prefix string, value string) error {
+	if strings.HasPrefix(value, prefix) {
+		value = prefix + leapSecond.ReplaceAllString(value[len(prefix):], "${1}59")
+	}
+	_, err := time.Parse(layout, value)
+	return err
+}
 
-	// date-time
-	DefineStringFormat("date-time", `^[0-9]{4}-(0[0-9]|10|11|12)-([0-2][0-9]|30|31)T[0-9]{2}:[0-9]{2}:[0-9]{2}(.[0-9]+)?(Z|(\+|-)[0-9]{2}:[0-9]{2})?$`)
+func validateDateTime(value string) error {
+	value = strings.ToUpper(value)
+	if len(value) < 11 || value[10] != 'T' {
+		return errors.New("is not a date-time of RFC 3339")
+	}
+	if err := parseLeapSecond(time.RFC3339, value[:11], value); err != nil {
+		return errors.New("is not a date-time of RFC 3339")
+	}
+	return nil
+}
+
+func validateTime(value string) error {
+	if err := parseLeapSecond("15:04:05Z07:00", "", strings.ToUpper(value)); err != nil {
+		return errors.New("is not a full-time of RFC 3339")
+	}
+	return nil
+}
+
+// durationPattern matches durations of ISO 8601, the checks of empty parts are done in validateDuration
+var durationPattern = regexp.MustCompile(`^P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+([.,]\d+)?S)?)?$`)
+
+func validateDuration(value string) error {
+	if !durationPattern.MatchString(value) || value == "P" || strings.HasSuffix(value, "T") {
+		return errors.New("is not a duration of ISO 8601")
+	}
+	return nil
+}
+
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+func validateHostname(value string) error {
+	if len(value) > 253 || !hostnamePattern.MatchString(value) {
+		return errors.New("is not a hostname of RFC 1123")
+	}
+	return nil
+}
+
+func validateIPv4(value string) error {
+	if ip := net.ParseIP(value); ip == nil || ip.To4() == nil || strings.Contains(value, ":") {
+		return errors.New("is not an IPv4 address")
+	}
+	return nil
+}
+
+func validateIPv6(value string) error {
+	if ip := net.ParseIP(value); ip == nil || !strings.Contains(value, ":") {
+		return errors.New("is not an IPv6 address")
+	}
+	return nil
+}
+
+func validateURI(value string) error {
+	if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+		return errors.New("is not an absolute URI")
+	}
+	return nil
+}
+
+func validateURIReference(value string) error {
+	if _, err := url.Parse(value); err != nil {
+		return errors.New("is not a URI reference")
+	}
+	return nil
+}
+
+func validateURITemplate(value string) error {
+	open := false
+	for _, c := range value {
+		switch {
+		case c == '{' && !open:
+			open = true
+		case c == '}' && open:
+			open = false
+		case c == '{' || c == '}':
+			return errors.New("is not a URI template of RFC 6570")
+		}
+	}
+	if open {
+		return errors.New("is not a URI template of RFC 6570")
+	}
+	return nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("is not a HTTP or HTTPS URL")
+	}
+	return nil
+}
+
+func validateRegex(value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Errorf("is not a regular expression: %v", err)
+	}
+	return nil
+}
+
+var epsgCodePattern = regexp.MustCompile(`^(?i:EPSG):[0-9]+$`)
+
+func validateEPSGCode(value string) error {
+	if !epsgCodePattern.MatchString(value) {
+		return errors.New("is not an EPSG code")
+	}
+	return nil
+}
+
+// wkt2Keywords are the keywords of the coordinate reference systems of WKT2 (ISO 19162)
+var wkt2Keywords = []string{
+	"GEODCRS", "GEODETICCRS", "GEOGCRS", "GEOGRAPHICCRS", "PROJCRS", "PROJECTEDCRS",
+	"VERTCRS", "VERTICALCRS", "ENGCRS", "ENGINEERINGCRS", "IMAGECRS", "PARAMETRICCRS",
+	"TIMECRS", "DERIVEDPROJCRS", "COMPOUNDCRS", "BOUNDCRS",
+}
+
+func validateWKT2(value string) error {
+	value = strings.TrimSpace(value)
+	keyword := strings.ToUpper(value)
+	if i := strings.IndexAny(keyword, "[("); i > 0 {
+		keyword = strings.TrimSpace(keyword[:i])
+	}
+	known := false
+	for _, k := range wkt2Keywords {
+		if keyword == k {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return errors.New("is not a CRS in WKT2")
+	}
+
+	// The brackets must be balanced, strings are quoted with doubled quotes inside
+	depth, quoted := 0, false
+	for i, c := range value {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+			if depth < 0 || (depth == 0 && i != len(value)-1) {
+				return errors.New("is not a CRS in WKT2, brackets are not balanced")
+			}
+		}
+	}
+	if depth != 0 || quoted {
+		return errors.New("is not a CRS in WKT2, brackets are not balanced")
+	}
+	return nil
+}
+
+func validatePROJJSON(value string) error {
+	var crs struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(value), &crs); err != nil || !strings.HasSuffix(crs.Type, "CRS") {
+		return errors.New("is not a CRS in PROJJSON")
+	}
+	return nil
+}
+
+// validateCRS accepts EPSG codes, WKT2, PROJJSON and the URIs of the OGC CRS register
+func validateCRS(value string) error {
+	if validateEPSGCode(value) == nil || validateWKT2(value) == nil || validatePROJJSON(value) == nil {
+		return nil
+	}
+	if strings.HasPrefix(value, "http://www.opengis.net/def/crs/") {
+		return nil
+	}
+	return errors.New("is neither an EPSG code, WKT2, PROJJSON nor an OGC CRS URI")
+}
+
+// validateBBox accepts bounding boxes of STAC and OGC API - Features as comma separated
+// numbers: west, south, east, north with optional minimum and maximum height
+func validateBBox(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 && len(parts) != 6 {
+		return errors.New("is not a bounding box of 4 or 6 comma separated numbers")
+	}
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return errors.New("is not a bounding box of 4 or 6 comma separated numbers")
+		}
+		numbers[i] = number
+	}
+	south, north := numbers[1], numbers[len(numbers)/2+1]
+	if south > north {
+		return errors.New("is not a bounding box, south is greater than north")
+	}
+	return nil
 }
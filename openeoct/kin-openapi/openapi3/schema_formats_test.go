@@ -0,0 +1,171 @@
+package openapi3_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3filter"
+	"github.com/stretchr/testify/require"
+)
+
+var formatExamples = []struct {
+	Format     string
+	AllValid   []string
+	AllInvalid []string
+}{
+	{"date", []string{"2020-02-29"}, []string{"2019-02-29", "2020-13-01", "20200101"}},
+	{"date-time",
+		[]string{"2020-01-01T00:00:00Z", "2020-01-01t00:00:00.5+01:00", "2016-12-31T23:59:60Z"},
+		[]string{"2020-01-01", "2020-01-01 00:00:00Z", "2020-01-01T00:00:00", "2020-01-01T24:00:00Z"}},
+	{"time", []string{"12:30:00Z", "23:59:60+00:00"}, []string{"12:30", "12:30:00"}},
+	{"duration", []string{"P1Y", "PT1H30M", "P1DT12H", "PT0.5S", "P2W"}, []string{"P", "PT", "1H", "P1H", "P1DT"}},
+	{"uri", []string{"https://openeo.org/", "urn:ogc:def:crs:EPSG::4326"}, []string{"/relative", "openeo.org"}},
+	{"uri-reference", []string{"/relative", "https://openeo.org/"}, []string{"%zz"}},
+	{"url", []string{"https://openeo.org/", "http://localhost:8080/jobs"}, []string{"ftp://openeo.org/", "https://", "openeo.org"}},
+	{"uuid", []string{"dd7d8481-81a3-407f-95f0-a2f1cb382a4b", "DD7D8481-81A3-407F-95F0-A2F1CB382A4B"}, []string{"dd7d8481", "gd7d8481-81a3-407f-95f0-a2f1cb382a4b"}},
+	{"commonmark", []string{"# Title\n\n*Description*"}, nil},
+	{"hostname", []string{"openeo.org", "localhost"}, []string{"-openeo.org", "openeo..org", "open eo.org"}},
+	{"ipv4", []string{"192.0.2.1"}, []string{"2001:db8::1", "256.0.0.1"}},
+	{"ipv6", []string{"2001:db8::1", "::ffff:192.0.2.1"}, []string{"192.0.2.1"}},
+	{"regex", []string{"^[a-z]+$"}, []string{"[a-z"}},
+	{"json-pointer", []string{"", "/a/0", "/a~1b"}, []string{"a", "/a~2"}},
+	{"epsg-code", []string{"EPSG:4326", "epsg:32633"}, []string{"4326", "EPSG:", "EPSG:43a"}},
+	{"wkt2-definition",
+		[]string{`GEOGCRS["WGS 84",DATUM["World Geodetic System 1984",ELLIPSOID["WGS 84",6378137,298.257223563]],CS[ellipsoidal,2]]`},
+		[]string{`GEOGCS["WGS 84"]`, `GEOGCRS["WGS 84"`, `GEOGCRS["WGS 84"]]`, `PROJCRS["a"] x`}},
+	{"projjson", []string{`{"type":"ProjectedCRS","name":"WGS 84 / UTM zone 33N"}`}, []string{`{"type":"Datum"}`, `EPSG:4326`}},
+	{"crs",
+		[]string{"EPSG:4326", `PROJCRS["a",BASEGEOGCRS["b"]]`, `{"type":"GeographicCRS"}`, "http://www.opengis.net/def/crs/OGC/1.3/CRS84"},
+		[]string{"WGS 84", "4326"}},
+	{"bbox", []string{"-10,40,10,50", "-10, 40, 0, 10, 50, 100"}, []string{"-10,40,10", "-10,50,10,40", "a,b,c,d"}},
+}
+
+func TestFormatValidators(t *testing.T) {
+	for _, example := range formatExamples {
+		t.Run(example.Format, func(t *testing.T) {
+			schema := openapi3.NewStringSchema().WithFormat(example.Format)
+			for _, value := range example.AllValid {
+				require.NoError(t, schema.VisitJSON(value, openapi3.FormatMode(openapi3.FormatStrict)), value)
+			}
+			for _, value := range example.AllInvalid {
+				err := schema.VisitJSON(value, openapi3.FormatMode(openapi3.FormatStrict))
+				require.Error(t, err, value)
+				require.Equal(t, "format", err.(*openapi3.SchemaError).SchemaField)
+			}
+		})
+	}
+}
+
+func TestFormatModes(t *testing.T) {
+	schema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewStringSchema().WithFormat("uuid")).
+		WithProperty("name", openapi3.NewStringSchema().WithFormat("openeo-name")).
+		WithProperty("links", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("url")))
+
+	valid := map[string]interface{}{"id": "dd7d8481-81a3-407f-95f0-a2f1cb382a4b", "name": "ndvi"}
+	mismatch := map[string]interface{}{"links": []interface{}{"https://openeo.org/", "openeo.org"}}
+
+	// Unknown formats
+	require.NoError(t, schema.VisitJSON(valid))
+	require.NoError(t, schema.VisitJSON(valid, openapi3.FormatMode(openapi3.FormatLenient)))
+	err := schema.VisitJSON(valid, openapi3.FormatMode(openapi3.FormatStrict))
+	require.Error(t, err)
+	require.Equal(t, "Format 'openeo-name' is unknown", err.(*openapi3.SchemaError).Reason)
+
+	// Mismatching formats
+	require.Error(t, schema.VisitJSON(mismatch))
+	require.False(t, schema.IsMatching(mismatch))
+
+	var warnings []*openapi3.SchemaError
+	warn := openapi3.FormatWarnings(func(err *openapi3.SchemaError) {
+		warnings = append(warnings, err)
+	})
+	require.NoError(t, schema.VisitJSON(mismatch, openapi3.FormatMode(openapi3.FormatWarn), warn))
+	require.Len(t, warnings, 1)
+	require.Equal(t, []string{"links", "1"}, warnings[0].JSONPointer())
+	require.Equal(t, "JSON string doesn't match the format 'url': is not a HTTP or HTTPS URL", warnings[0].Reason)
+
+	warnings = nil
+	require.NoError(t, schema.VisitJSON(valid, openapi3.FormatMode(openapi3.FormatWarn), warn))
+	require.Len(t, warnings, 1)
+	require.Equal(t, []string{"name"}, warnings[0].JSONPointer())
+}
+
+func TestFormatWarningsOfMatchingBranch(t *testing.T) {
+	withURL := openapi3.NewObjectSchema().WithProperty("url", openapi3.NewStringSchema().WithFormat("url"))
+	withURL.Required = []string{"url"}
+	withURI := openapi3.NewObjectSchema().WithProperty("uri", openapi3.NewStringSchema().WithFormat("uri"))
+	withURI.Required = []string{"uri"}
+	schema := openapi3.NewOneOfSchema(withURL, withURI)
+
+	var warnings []*openapi3.SchemaError
+	err := schema.VisitJSON(map[string]interface{}{"url": "openeo.org"}, openapi3.FormatMode(openapi3.FormatWarn),
+		openapi3.FormatWarnings(func(err *openapi3.SchemaError) {
+			warnings = append(warnings, err)
+		}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Equal(t, []string{"url"}, warnings[0].JSONPointer())
+}
+
+func TestDefineStringFormatValidator(t *testing.T) {
+	openapi3.DefineStringFormatValidator("openeo-process-id", func(value string) error {
+		if value == "" || value[0] < 'a' || value[0] > 'z' {
+			return errors.New("must start with a lower case letter")
+		}
+		return nil
+	})
+	defer delete(openapi3.SchemaStringFormats, "openeo-process-id")
+
+	schema := openapi3.NewStringSchema().WithFormat("openeo-process-id")
+	require.NoError(t, schema.Validate(context.Background()))
+	require.NoError(t, schema.VisitJSON("ndvi"))
+	err := schema.VisitJSON("NDVI")
+	require.Error(t, err)
+	require.Equal(t, "JSON string doesn't match the format 'openeo-process-id': must start with a lower case letter", err.(*openapi3.SchemaError).Reason)
+}
+
+func TestSampleGeneratorFormats(t *testing.T) {
+	formats := make([]string, 0, len(openapi3.SchemaStringFormats))
+	for format := range openapi3.SchemaStringFormats {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	generator := openapi3.NewSampleGenerator(1)
+	for _, format := range formats {
+		schema := openapi3.NewStringSchema().WithFormat(format)
+		value, err := generator.Generate(schema)
+		require.NoError(t, err, format)
+		require.NoError(t, schema.VisitJSON(value, openapi3.FormatMode(openapi3.FormatStrict)), format)
+	}
+}
+
+func TestUnknownFormatInSpec(t *testing.T) {
+	spec := []byte(`{
+  "openapi": "3.0.0",
+  "info": {"title": "openEO", "version": "1.0.0"},
+  "paths": {
+    "/jobs/{job_id}": {
+      "get": {
+        "parameters": [{"name": "job_id", "in": "path", "required": true, "schema": {"type": "string", "format": "openeo-job-id"}}],
+        "responses": {"200": {"description": "Job"}}
+      }
+    }
+  }
+}`)
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(spec)
+	require.NoError(t, err)
+
+	require.NoError(t, swagger.Validate(context.Background()))
+	require.NoError(t, swagger.Validate(openapi3.ContextWithFormatMode(context.Background(), openapi3.FormatLenient)))
+	require.NoError(t, swagger.Validate(openapi3.ContextWithFormatMode(context.Background(), openapi3.FormatWarn)))
+	err = swagger.Validate(openapi3.ContextWithFormatMode(context.Background(), openapi3.FormatStrict))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Unsupported 'format' value 'openeo-job-id'")
+
+	require.NotPanics(t, func() { openapi3filter.NewRouter().WithSwagger(swagger) })
+}
@@ -0,0 +1,547 @@
+package openapi3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// DefaultSampleMaxDepth is the default nesting depth up to which optional properties and items are generated.
+const DefaultSampleMaxDepth = 6
+
+// sampleAttempts is the number of instances generated for a schema until one is valid.
+const sampleAttempts = 20
+
+// ErrSampleNotGenerated is returned if no valid instance of a schema could be generated.
+var ErrSampleNotGenerated = errors.New("No valid instance of the schema could be generated")
+
+// SampleStringFormats generates strings of the formats that can not be derived from a pattern.
+var SampleStringFormats = map[string]func(r *rand.Rand) string{
+	"date": func(r *rand.Rand) string {
+		return fmt.Sprintf("%04d-%02d-%02d", 2000+r.Intn(30), 1+r.Intn(12), 1+r.Intn(28))
+	},
+	"date-time": func(r *rand.Rand) string {
+		return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02dZ", 2000+r.Intn(30), 1+r.Intn(12), 1+r.Intn(28), r.Intn(24), r.Intn(60), r.Intn(60))
+	},
+	"time": func(r *rand.Rand) string {
+		return fmt.Sprintf("%02d:%02d:%02dZ", r.Intn(24), r.Intn(60), r.Intn(60))
+	},
+	"duration": func(r *rand.Rand) string {
+		return fmt.Sprintf("P%dDT%dH", 1+r.Intn(30), r.Intn(24))
+	},
+	"email": func(r *rand.Rand) string {
+		return sampleWord(r, 3, 8) + "@example.com"
+	},
+	"idn-email": func(r *rand.Rand) string {
+		return sampleWord(r, 3, 8) + "@example.com"
+	},
+	"uuid": func(r *rand.Rand) string {
+		b := make([]byte, 16)
+		r.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	},
+	"uri": func(r *rand.Rand) string {
+		return "https://example.com/" + sampleWord(r, 3, 8)
+	},
+	"url": func(r *rand.Rand) string {
+		return "https://example.com/" + sampleWord(r, 3, 8)
+	},
+	"iri": func(r *rand.Rand) string {
+		return "https://example.com/" + sampleWord(r, 3, 8)
+	},
+	"uri-reference": func(r *rand.Rand) string {
+		return "/" + sampleWord(r, 3, 8)
+	},
+	"iri-reference": func(r *rand.Rand) string {
+		return "/" + sampleWord(r, 3, 8)
+	},
+	"json-pointer": func(r *rand.Rand) string {
+		return "/" + sampleWord(r, 3, 8)
+	},
+	"relative-json-pointer": func(r *rand.Rand) string {
+		return fmt.Sprintf("%d/%s", r.Intn(3), sampleWord(r, 3, 8))
+	},
+	"hostname": func(r *rand.Rand) string {
+		return sampleWord(r, 3, 8) + ".example.com"
+	},
+	"ipv4": func(r *rand.Rand) string {
+		return fmt.Sprintf("192.0.2.%d", 1+r.Intn(254))
+	},
+	"ipv6": func(r *rand.Rand) string {
+		return fmt.Sprintf("2001:db8::%x", 1+r.Intn(0xfffe))
+	},
+	"byte": func(r *rand.Rand) string {
+		b := make([]byte, 3+r.Intn(12))
+		r.Read(b)
+		return base64.StdEncoding.EncodeToString(b)
+	},
+	"epsg-code": func(r *rand.Rand) string {
+		return sampleEPSGCodes[r.Intn(len(sampleEPSGCodes))]
+	},
+	"crs": func(r *rand.Rand) string {
+		return sampleEPSGCodes[r.Intn(len(sampleEPSGCodes))]
+	},
+	"wkt2-definition": func(r *rand.Rand) string {
+		return `GEOGCRS["WGS 84",DATUM["World Geodetic System 1984",ELLIPSOID["WGS 84",6378137,298.257223563]],CS[ellipsoidal,2],AXIS["latitude",north],AXIS["longitude",east],ANGLEUNIT["degree",0.0174532925199433]]`
+	},
+	"projjson": func(r *rand.Rand) string {
+		return `{"type":"GeographicCRS","name":"WGS 84","id":{"authority":"EPSG","code":4326}}`
+	},
+	"bbox": func(r *rand.Rand) string {
+		west, south := -180+r.Float64()*180, -90+r.Float64()*90
+		return fmt.Sprintf("%.4f,%.4f,%.4f,%.4f", west, south, west+r.Float64()*180, south+r.Float64()*90)
+	},
+}
+
+// sampleEPSGCodes are common EPSG codes of coordinate reference systems
+var sampleEPSGCodes = []string{"EPSG:4326", "EPSG:3857", "EPSG:32633", "EPSG:3035"}
+
+// SampleGenerator generates instances of schemas, e.g. for request bodies, mock responses and fuzzing.
+// The instances are JSON values as returned by json.Unmarshal. Generators with the same seed
+// generate the same instances for the same sequence of schemas.
+type SampleGenerator struct {
+	// MaxDepth is the nesting depth up to which optional properties and more than the minimum
+	// number of items are generated. Deeper objects and arrays get their required properties
+	// and minimum number of items only.
+	MaxDepth int
+	// RequiredOnly omits optional properties on all levels.
+	RequiredOnly bool
+	// UseExamples returns the example or default value of a schema, if it matches the schema.
+	UseExamples bool
+	// ValidationOptions are used to validate the generated instances. With VisitAsRequest,
+	// read-only properties are omitted, with VisitAsResponse write-only properties.
+	ValidationOptions []SchemaValidationOption
+
+	rand *rand.Rand
+}
+
+// NewSampleGenerator creates a generator with the given seed.
+func NewSampleGenerator(seed int64) *SampleGenerator {
+	return &SampleGenerator{
+		MaxDepth: DefaultSampleMaxDepth,
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Generate returns an instance matching the schema. The generation is repeated a few times
+// if the instance does not match, e.g. because of a pattern and a length constraint.
+func (g *SampleGenerator) Generate(schema *Schema) (interface{}, error) {
+	var err error
+	for i := 0; i < sampleAttempts; i++ {
+		var value interface{}
+		if value, err = g.generate(schema, 0); err != nil {
+			continue
+		}
+		if err = schema.VisitJSON(value, g.ValidationOptions...); err == nil {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: %v", ErrSampleNotGenerated, err)
+}
+
+func (g *SampleGenerator) generate(schema *Schema, depth int) (interface{}, error) {
+	if schema == nil {
+		return nil, errors.New("Schema is not resolved")
+	}
+
+	if g.UseExamples {
+		examples := append([]interface{}{schema.Example, schema.Default}, schema.Examples...)
+		for _, example := range examples {
+			if example != nil && schema.VisitJSON(example, g.ValidationOptions...) == nil {
+				return example, nil
+			}
+		}
+	}
+
+	if schema.Const != nil {
+		return schema.Const, nil
+	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[g.rand.Intn(len(schema.Enum))], nil
+	}
+
+	if len(schema.AllOf) > 0 || len(schema.OneOf) > 0 || len(schema.AnyOf) > 0 {
+		return g.generateComposed(schema, depth)
+	}
+
+	switch g.sampleType(schema) {
+	case "object":
+		return g.generateObject(schema, depth)
+	case "array":
+		return g.generateArray(schema, depth)
+	case "string":
+		return g.generateString(schema)
+	case "integer":
+		return g.generateNumber(schema, true)
+	case "number":
+		return g.generateNumber(schema, false)
+	case "boolean":
+		return g.rand.Intn(2) == 0, nil
+	case "null":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported type %q", schema.typeNames())
+}
+
+// sampleType returns the type of the schema, derived from its constraints if no type is given.
+func (g *SampleGenerator) sampleType(schema *Schema) string {
+	if schema.Type != "" {
+		return schema.Type
+	}
+	if len(schema.Types) > 0 {
+		return schema.Types[g.rand.Intn(len(schema.Types))]
+	}
+	switch {
+	case len(schema.Properties) > 0 || len(schema.Required) > 0 || schema.AdditionalProperties != nil:
+		return "object"
+	case schema.Items != nil || len(schema.PrefixItems) > 0:
+		return "array"
+	case schema.Min != nil || schema.Max != nil || schema.MultipleOf != nil ||
+		schema.ExclusiveMinValue != nil || schema.ExclusiveMaxValue != nil:
+		return "number"
+	}
+	return "string"
+}
+
+// generateComposed merges the own properties of the schema with the instances of all allOf schemas
+// and of a random oneOf or anyOf schema. The discriminator property is set to the name of the chosen schema.
+func (g *SampleGenerator) generateComposed(schema *Schema, depth int) (interface{}, error) {
+	var parts []*Schema
+	for _, ref := range schema.AllOf {
+		parts = append(parts, ref.Value)
+	}
+
+	alternatives := schema.OneOf
+	if len(alternatives) == 0 {
+		alternatives = schema.AnyOf
+	}
+	var chosen *SchemaRef
+	if len(alternatives) > 0 {
+		chosen = alternatives[g.rand.Intn(len(alternatives))]
+		parts = append(parts, chosen.Value)
+	}
+
+	var merged map[string]interface{}
+	if schema.Type == "object" || len(schema.Properties) > 0 || len(schema.Required) > 0 {
+		object, err := g.generateObject(schema, depth)
+		if err != nil {
+			return nil, err
+		}
+		merged = object.(map[string]interface{})
+	}
+
+	for _, part := range parts {
+		value, err := g.generate(part, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			if merged == nil {
+				return value, nil
+			}
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]interface{}, len(object))
+		}
+		for key, item := range object {
+			if _, exists := merged[key]; !exists {
+				merged[key] = item
+			}
+		}
+	}
+
+	if discriminator := schema.Discriminator; discriminator != nil && chosen != nil && merged != nil {
+		if name := discriminatorValue(discriminator, chosen); name != "" {
+			merged[discriminator.PropertyName] = name
+		}
+	}
+
+	return merged, nil
+}
+
+// discriminatorValue returns the value of the discriminator property identifying the schema:
+// its key in the mapping or else the name of the referenced schema.
+func discriminatorValue(discriminator *Discriminator, ref *SchemaRef) string {
+	if ref.Ref == "" {
+		return ""
+	}
+	names := make([]string, 0, len(discriminator.Mapping))
+	for name := range discriminator.Mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if discriminator.Mapping[name] == ref.Ref {
+			return name
+		}
+	}
+	return ref.Ref[strings.LastIndex(ref.Ref, "/")+1:]
+}
+
+func (g *SampleGenerator) generateObject(schema *Schema, depth int) (interface{}, error) {
+	object := make(map[string]interface{})
+
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	// Sorted for deterministic results
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	settings := newSchemaValidationSettings(g.ValidationOptions...)
+	optional := !g.RequiredOnly && depth < g.MaxDepth
+	for _, name := range names {
+		if !required[name] && !optional {
+			continue
+		}
+		if property := schema.Properties[name].Value; property != nil && settings.excludes(property) {
+			continue
+		}
+		value, err := g.generate(schema.Properties[name].Value, depth+1)
+		if err != nil {
+			if required[name] {
+				return nil, err
+			}
+			continue
+		}
+		object[name] = value
+	}
+
+	for _, name := range schema.Required {
+		if property := schema.Properties[name]; property != nil && property.Value != nil && settings.excludes(property.Value) {
+			continue
+		}
+		if _, ok := object[name]; !ok {
+			object[name] = g.sampleWord()
+		}
+	}
+
+	for i := 0; uint64(len(object)) < schema.MinProps && i < 100; i++ {
+		name := g.sampleWord()
+		if _, ok := object[name]; ok {
+			continue
+		}
+		if additional := schema.AdditionalProperties; additional != nil {
+			value, err := g.generate(additional.Value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			object[name] = value
+		} else {
+			object[name] = g.sampleWord()
+		}
+	}
+
+	return object, nil
+}
+
+func (g *SampleGenerator) generateArray(schema *Schema, depth int) (interface{}, error) {
+	count := int(schema.MinItems)
+	if count < len(schema.PrefixItems) {
+		count = len(schema.PrefixItems)
+	}
+	if depth < g.MaxDepth {
+		max := count + 2
+		if schema.MaxItems != nil && uint64(max) > *schema.MaxItems {
+			max = int(*schema.MaxItems)
+		}
+		// A maxItems below minItems or the prefix items can not be satisfied, the validation of the sample fails
+		if max < count {
+			max = count
+		}
+		count += g.rand.Intn(max - count + 1)
+	}
+
+	items := make([]interface{}, 0, count)
+	seen := make(map[string]bool, count)
+	for i := 0; len(items) < count && i < count*10; i++ {
+		var item interface{}
+		itemSchema := schema.Items
+		if len(items) < len(schema.PrefixItems) {
+			itemSchema = schema.PrefixItems[len(items)]
+		}
+		if itemSchema == nil {
+			item = g.sampleWord()
+		} else {
+			var err error
+			if item, err = g.generate(itemSchema.Value, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		if schema.UniqueItems {
+			key, _ := json.Marshal(item)
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (g *SampleGenerator) generateString(schema *Schema) (interface{}, error) {
+	var value string
+	if schema.Pattern != "" {
+		re, err := syntax.Parse(schema.Pattern, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		value = g.samplePattern(re.Simplify())
+	} else if format, ok := SampleStringFormats[schema.Format]; ok {
+		value = format(g.rand)
+	} else {
+		value = g.sampleWord()
+	}
+
+	// Patterns and formats are not padded or cut, the instance is generated again instead
+	if schema.Pattern == "" && schema.Format == "" {
+		for uint64(len(value)) < schema.MinLength {
+			value += g.sampleWord()
+		}
+		if max := schema.MaxLength; max != nil && uint64(len(value)) > *max {
+			value = value[:*max]
+		}
+	}
+	return value, nil
+}
+
+func (g *SampleGenerator) generateNumber(schema *Schema, integer bool) (interface{}, error) {
+	// The numeric exclusive limits of JSON Schema 2020-12 replace minimum and maximum
+	lower, upper := schema.Min, schema.Max
+	exclusiveMin, exclusiveMax := schema.ExclusiveMin, schema.ExclusiveMax
+	if schema.ExclusiveMinValue != nil {
+		lower, exclusiveMin = schema.ExclusiveMinValue, true
+	}
+	if schema.ExclusiveMaxValue != nil {
+		upper, exclusiveMax = schema.ExclusiveMaxValue, true
+	}
+
+	min, max := -1000.0, 1000.0
+	if lower != nil {
+		min = *lower
+		if upper == nil {
+			max = min + 1000
+		}
+	}
+	if upper != nil {
+		max = *upper
+		if lower == nil {
+			min = max - 1000
+		}
+	}
+
+	step := 0.0
+	if integer {
+		step = 1
+	}
+	if schema.MultipleOf != nil {
+		step = *schema.MultipleOf
+	}
+	if step > 0 {
+		low, high := math.Ceil(min/step), math.Floor(max/step)
+		if exclusiveMin && low*step <= min {
+			low++
+		}
+		if exclusiveMax && high*step >= max {
+			high--
+		}
+		if low > high {
+			return nil, fmt.Errorf("No number between %v and %v", min, max)
+		}
+		if high-low > 1e9 {
+			high = low + 1e9
+		}
+		return (low + float64(g.rand.Int63n(int64(high-low)+1))) * step, nil
+	}
+
+	value := min + g.rand.Float64()*(max-min)
+	if (exclusiveMin && value <= min) || (exclusiveMax && value >= max) {
+		value = (min + max) / 2
+	}
+	return value, nil
+}
+
+// samplePattern generates a string matching the regular expression.
+// Repetitions without upper bound are repeated up to three times more than their minimum.
+func (g *SampleGenerator) samplePattern(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCharClass:
+		// Pairs of inclusive ranges, printable ASCII characters are preferred
+		var printable []rune
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for c := re.Rune[i]; c <= re.Rune[i+1] && c <= '~'; c++ {
+				if c >= ' ' {
+					printable = append(printable, c)
+				}
+			}
+		}
+		if len(printable) > 0 {
+			return string(printable[g.rand.Intn(len(printable))])
+		}
+		if len(re.Rune) > 1 {
+			return string(re.Rune[0])
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return string(rune('a' + g.rand.Intn(26)))
+	case syntax.OpCapture:
+		return g.samplePattern(re.Sub[0])
+	case syntax.OpConcat:
+		var b strings.Builder
+		for _, sub := range re.Sub {
+			b.WriteString(g.samplePattern(sub))
+		}
+		return b.String()
+	case syntax.OpAlternate:
+		return g.samplePattern(re.Sub[g.rand.Intn(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, -1
+		case syntax.OpPlus:
+			min, max = 1, -1
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + 3
+		}
+		var b strings.Builder
+		for i := min + g.rand.Intn(max-min+1); i > 0; i-- {
+			b.WriteString(g.samplePattern(re.Sub[0]))
+		}
+		return b.String()
+	}
+	// Anchors, word boundaries and empty matches
+	return ""
+}
+
+func (g *SampleGenerator) sampleWord() string {
+	return sampleWord(g.rand, 3, 10)
+}
+
+func sampleWord(r *rand.Rand, min int, max int) string {
+	b := make([]byte, min+r.Intn(max-min+1))
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
@@ -0,0 +1,237 @@
+package openapi3_test
+
+import (
+	"testing"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleSchemas = []struct {
+	Title  string
+	Schema *openapi3.Schema
+}{
+	{"BOOLEAN", openapi3.NewBoolSchema()},
+	{"INTEGER RANGE", openapi3.NewIntegerSchema().WithMin(3).WithMax(5)},
+	{"INTEGER EXCLUSIVE", openapi3.NewIntegerSchema().WithMin(3).WithMax(5).WithExclusiveMin(true).WithExclusiveMax(true)},
+	{"NUMBER MULTIPLE OF", &openapi3.Schema{Type: "number", Min: openapi3.Float64Ptr(1), MultipleOf: openapi3.Float64Ptr(0.25)}},
+	{"NUMBER NEGATIVE", openapi3.NewFloat64Schema().WithMax(-10)},
+	{"STRING LENGTH", openapi3.NewStringSchema().WithMinLength(20).WithMaxLength(22)},
+	{"STRING PATTERN", openapi3.NewStringSchema().WithPattern(`^[A-Z]{2}-[0-9]{3,5}(_(a|b))?$`)},
+	{"STRING PATTERN NEGATED CLASS", openapi3.NewStringSchema().WithPattern(`^/[^/]+/[^/]+$`)},
+	{"STRING DATE", &openapi3.Schema{Type: "string", Format: "date"}},
+	{"STRING DATE-TIME", openapi3.NewDateTimeSchema()},
+	{"STRING EMAIL", &openapi3.Schema{Type: "string", Format: "email"}},
+	{"STRING UUID", openapi3.NewUUIDSchema()},
+	{"STRING BYTES", openapi3.NewBytesSchema()},
+	{"ENUM", openapi3.NewStringSchema().WithEnum("a", "b", "c")},
+	{"ARRAY", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).WithMinItems(2).WithMaxItems(3)},
+	{"ARRAY UNIQUE", openapi3.NewArraySchema().WithItems(openapi3.NewBoolSchema()).WithMinItems(2).WithUniqueItems(true)},
+	{"OBJECT", openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema().WithMinLength(1)).
+		WithProperty("count", openapi3.NewIntegerSchema().WithMin(0)).
+		WithProperty("tags", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())),
+	},
+	{"OBJECT REQUIRED", &openapi3.Schema{
+		Type:     "object",
+		Required: []string{"id", "name"},
+		Properties: map[string]*openapi3.SchemaRef{
+			"id": openapi3.NewStringSchema().WithPattern(`^[a-z]+$`).NewRef(),
+		},
+	}},
+	{"OBJECT MIN PROPERTIES", &openapi3.Schema{
+		Type:                 "object",
+		MinProps:             3,
+		AdditionalProperties: openapi3.NewIntegerSchema().NewRef(),
+	}},
+	{"ALL OF", openapi3.NewAllOfSchema(
+		&openapi3.Schema{Type: "object", Required: []string{"a"}, Properties: map[string]*openapi3.SchemaRef{"a": openapi3.NewStringSchema().NewRef()}},
+		&openapi3.Schema{Type: "object", Required: []string{"b"}, Properties: map[string]*openapi3.SchemaRef{"b": openapi3.NewBoolSchema().NewRef()}},
+	)},
+	{"ONE OF", openapi3.NewOneOfSchema(openapi3.NewBoolSchema(), openapi3.NewStringSchema().WithMinLength(5))},
+	{"ANY OF", openapi3.NewAnyOfSchema(openapi3.NewIntegerSchema().WithMax(0), openapi3.NewArraySchema().WithItems(openapi3.NewBoolSchema()))},
+	{"TYPE ARRAY", &openapi3.Schema{Types: []string{"string", "integer", "null"}, Nullable: true}},
+	{"CONST", &openapi3.Schema{Const: "openEO"}},
+	{"EXCLUSIVE VALUES", &openapi3.Schema{Type: "integer", ExclusiveMinValue: openapi3.Float64Ptr(3), ExclusiveMaxValue: openapi3.Float64Ptr(5)}},
+	{"PREFIX ITEMS", &openapi3.Schema{
+		Type:        "array",
+		PrefixItems: []*openapi3.SchemaRef{openapi3.NewStringSchema().NewRef(), openapi3.NewBoolSchema().NewRef()},
+		Items:       openapi3.NewIntegerSchema().NewRef(),
+	}},
+}
+
+func TestSampleGenerator(t *testing.T) {
+	for _, example := range sampleSchemas {
+		t.Run(example.Title, func(t *testing.T) {
+			g := openapi3.NewSampleGenerator(42)
+			for i := 0; i < 50; i++ {
+				value, err := g.Generate(example.Schema)
+				require.NoError(t, err)
+				require.NoError(t, validateSchema(t, example.Schema, value))
+			}
+		})
+	}
+}
+
+func TestSampleGeneratorSeed(t *testing.T) {
+	schema := openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("value", openapi3.NewFloat64Schema()).
+		WithProperty("list", openapi3.NewArraySchema().WithItems(openapi3.NewIntegerSchema()))
+
+	generate := func(seed int64) []interface{} {
+		g := openapi3.NewSampleGenerator(seed)
+		var values []interface{}
+		for i := 0; i < 10; i++ {
+			value, err := g.Generate(schema)
+			require.NoError(t, err)
+			values = append(values, value)
+		}
+		return values
+	}
+
+	require.Equal(t, generate(1), generate(1))
+	require.NotEqual(t, generate(1), generate(2))
+}
+
+func TestSampleGeneratorExamples(t *testing.T) {
+	schema := openapi3.NewStringSchema().WithPattern(`^[a-z]+$`)
+	schema.Example = "example"
+
+	g := openapi3.NewSampleGenerator(1)
+	value, err := g.Generate(schema)
+	require.NoError(t, err)
+	require.NotEqual(t, "example", value)
+
+	g.UseExamples = true
+	value, err = g.Generate(schema)
+	require.NoError(t, err)
+	require.Equal(t, "example", value)
+
+	// Examples not matching the schema are not used
+	schema.Example = "Invalid Example"
+	value, err = g.Generate(schema)
+	require.NoError(t, err)
+	require.NotEqual(t, "Invalid Example", value)
+}
+
+func TestSampleGeneratorRequiredOnly(t *testing.T) {
+	schema := &openapi3.Schema{
+		Type:     "object",
+		Required: []string{"a"},
+		Properties: map[string]*openapi3.SchemaRef{
+			"a": openapi3.NewStringSchema().NewRef(),
+			"b": openapi3.NewStringSchema().NewRef(),
+		},
+	}
+
+	g := openapi3.NewSampleGenerator(1)
+	g.RequiredOnly = true
+	value, err := g.Generate(schema)
+	require.NoError(t, err)
+	require.Len(t, value, 1)
+	require.Contains(t, value, "a")
+}
+
+func TestSampleGeneratorRecursive(t *testing.T) {
+	node := openapi3.NewObjectSchema()
+	node.Required = []string{"name"}
+	node.WithProperty("name", openapi3.NewStringSchema())
+	node.WithPropertyRef("children", openapi3.NewArraySchema().WithItems(node).NewRef())
+
+	value, err := openapi3.NewSampleGenerator(1).Generate(node)
+	require.NoError(t, err)
+	require.NoError(t, validateSchema(t, node, value))
+}
+
+func TestSampleGeneratorUnsatisfiable(t *testing.T) {
+	schema := openapi3.NewStringSchema()
+	schema.Not = openapi3.NewStringSchema().NewRef()
+
+	_, err := openapi3.NewSampleGenerator(1).Generate(schema)
+	require.Error(t, err)
+}
+
+func TestSampleGeneratorMaxItemsBelowMinimum(t *testing.T) {
+	schemas := map[string]*openapi3.Schema{
+		"MIN ITEMS": openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).WithMinItems(3).WithMaxItems(1),
+		"PREFIX ITEMS": {
+			Type:        "array",
+			PrefixItems: []*openapi3.SchemaRef{openapi3.NewStringSchema().NewRef(), openapi3.NewBoolSchema().NewRef()},
+			MaxItems:    openapi3.Uint64Ptr(1),
+		},
+	}
+	for title, schema := range schemas {
+		t.Run(title, func(t *testing.T) {
+			require.NotPanics(t, func() {
+				_, err := openapi3.NewSampleGenerator(1).Generate(schema)
+				require.Error(t, err)
+			})
+		})
+	}
+}
+
+var jsonSpecWithSampleDiscriminator = []byte(`
+{
+	"openapi": "3.0.0",
+	"info": {"title": "Pets", "version": "1.0.0"},
+	"paths": {},
+	"components": {
+		"schemas": {
+			"Pet": {
+				"discriminator": {
+					"propertyName": "pet_type",
+					"mapping": {
+						"cat": "#/components/schemas/Cat"
+					}
+				},
+				"oneOf": [
+					{"$ref": "#/components/schemas/Cat"},
+					{"$ref": "#/components/schemas/Dog"}
+				]
+			},
+			"Cat": {
+				"type": "object",
+				"required": ["pet_type", "lives"],
+				"properties": {
+					"pet_type": {"type": "string"},
+					"lives": {"type": "integer", "minimum": 1, "maximum": 9}
+				}
+			},
+			"Dog": {
+				"type": "object",
+				"required": ["pet_type", "bark"],
+				"properties": {
+					"pet_type": {"type": "string"},
+					"bark": {"type": "boolean"}
+				},
+				"additionalProperties": false
+			}
+		}
+	}
+}
+`)
+
+func TestSampleGeneratorDiscriminator(t *testing.T) {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(jsonSpecWithSampleDiscriminator)
+	require.NoError(t, err)
+	schema := swagger.Components.Schemas["Pet"].Value
+
+	g := openapi3.NewSampleGenerator(1)
+	types := make(map[interface{}]bool)
+	for i := 0; i < 20; i++ {
+		value, err := g.Generate(schema)
+		require.NoError(t, err)
+		object := value.(map[string]interface{})
+		switch object["pet_type"] {
+		case "cat":
+			require.Contains(t, object, "lives")
+		case "Dog":
+			require.Contains(t, object, "bark")
+		default:
+			t.Fatalf("unexpected discriminator value %v", object["pet_type"])
+		}
+		types[object["pet_type"]] = true
+	}
+	require.Len(t, types, 2)
+}
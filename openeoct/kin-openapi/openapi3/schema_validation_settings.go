@@ -0,0 +1,93 @@
+package openapi3
+
+// SchemaValidationOption describes options of the validation of values against schemas.
+type SchemaValidationOption func(*schemaValidationSettings)
+
+type schemaValidationSettings struct {
+	failfast bool
+	asreq    bool
+	asrep    bool
+
+	formatMode     FormatValidationMode
+	formatWarnings func(err *SchemaError)
+	// Set for the values of tried subschemas, whose warnings are not reported
+	silent bool
+	// Location of the visited value, tracked for the warnings only
+	path []string
+}
+
+// VisitAsRequest validates the value as part of a request: properties with readOnly
+// must not be present and are not required.
+func VisitAsRequest() SchemaValidationOption {
+	return func(s *schemaValidationSettings) { s.asreq, s.asrep = true, false }
+}
+
+// VisitAsResponse validates the value as part of a response: properties with writeOnly
+// must not be present and are not required.
+func VisitAsResponse() SchemaValidationOption {
+	return func(s *schemaValidationSettings) { s.asreq, s.asrep = false, true }
+}
+
+// FormatMode sets the handling of the formats of strings, FormatLenient by default.
+func FormatMode(mode FormatValidationMode) SchemaValidationOption {
+	return func(s *schemaValidationSettings) { s.formatMode = mode }
+}
+
+// FormatWarnings sets the handler of the format mismatches found in FormatWarn mode.
+// The errors point to the mismatching strings.
+func FormatWarnings(handler func(err *SchemaError)) SchemaValidationOption {
+	return func(s *schemaValidationSettings) { s.formatWarnings = handler }
+}
+
+// failFast returns errSchema on the first error instead of a detailed SchemaError.
+func failFast() SchemaValidationOption {
+	return func(s *schemaValidationSettings) { s.failfast = true }
+}
+
+func newSchemaValidationSettings(opts ...SchemaValidationOption) *schemaValidationSettings {
+	settings := &schemaValidationSettings{}
+	for _, opt := range opts {
+		opt(settings)
+	}
+	return settings
+}
+
+// fast returns a copy of the settings for checks whose errors and warnings are not reported
+func (settings schemaValidationSettings) fast() *schemaValidationSettings {
+	settings.failfast = true
+	settings.silent = true
+	return &settings
+}
+
+// silenced returns a copy of the settings for checks whose warnings are not reported
+func (settings schemaValidationSettings) silenced() *schemaValidationSettings {
+	settings.failfast = false
+	settings.silent = true
+	return &settings
+}
+
+// detailed returns a copy of the settings for checks whose errors are reported
+func (settings schemaValidationSettings) detailed() *schemaValidationSettings {
+	settings.failfast = false
+	return &settings
+}
+
+// child returns a copy of the settings for the reported checks of an item or property
+func (settings schemaValidationSettings) child(key string) *schemaValidationSettings {
+	settings.failfast = false
+	if settings.formatWarnings != nil {
+		settings.path = append(settings.path[:len(settings.path):len(settings.path)], key)
+	}
+	return &settings
+}
+
+// warns tells whether format mismatches are reported as warnings
+func (settings schemaValidationSettings) warns() bool {
+	return settings.formatMode == FormatWarn && settings.formatWarnings != nil && !settings.silent
+}
+
+// excludes tells whether the property must not be present in the request or response
+// that is validated, and is not required there.
+func (settings schemaValidationSettings) excludes(property *Schema) bool {
+	return (settings.asreq && property.ReadOnly) || (settings.asrep && property.WriteOnly)
+}
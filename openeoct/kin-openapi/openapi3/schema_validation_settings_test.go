@@ -0,0 +1,80 @@
+package openapi3_test
+
+import (
+	"testing"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func newJobSchema() *openapi3.Schema {
+	id := openapi3.NewStringSchema()
+	id.ReadOnly = true
+	status := openapi3.NewStringSchema()
+	status.ReadOnly = true
+	plan := openapi3.NewStringSchema()
+	plan.WriteOnly = true
+	return openapi3.NewObjectSchema().
+		WithProperty("id", id).
+		WithProperty("status", status).
+		WithProperty("plan", plan).
+		WithProperty("title", openapi3.NewStringSchema())
+}
+
+func TestReadOnlyWriteOnly(t *testing.T) {
+	schema := newJobSchema()
+	schema.Required = []string{"id", "status", "plan"}
+
+	request := map[string]interface{}{"title": "NDVI", "plan": "free"}
+	response := map[string]interface{}{"id": "a1", "status": "created", "title": "NDVI"}
+	full := map[string]interface{}{"id": "a1", "status": "created", "title": "NDVI", "plan": "free"}
+
+	require.NoError(t, schema.VisitJSON(request, openapi3.VisitAsRequest()))
+	require.NoError(t, schema.VisitJSON(response, openapi3.VisitAsResponse()))
+	require.NoError(t, schema.VisitJSON(full))
+	require.Error(t, schema.VisitJSON(request))
+
+	err := schema.VisitJSON(full, openapi3.VisitAsRequest())
+	require.Error(t, err)
+	schemaErr, ok := err.(*openapi3.SchemaError)
+	require.True(t, ok)
+	require.Equal(t, "readOnly", schemaErr.SchemaField)
+	require.Contains(t, []string{"id", "status"}, schemaErr.JSONPointer()[0])
+
+	err = schema.VisitJSON(full, openapi3.VisitAsResponse())
+	require.Error(t, err)
+	schemaErr, ok = err.(*openapi3.SchemaError)
+	require.True(t, ok)
+	require.Equal(t, "writeOnly", schemaErr.SchemaField)
+	require.Equal(t, []string{"plan"}, schemaErr.JSONPointer())
+	require.Equal(t, "Property 'plan' is write-only", schemaErr.Reason)
+
+	require.False(t, schema.IsMatching(request))
+}
+
+func TestReadOnlyNested(t *testing.T) {
+	schema := openapi3.NewArraySchema().WithItems(openapi3.NewAllOfSchema(newJobSchema()))
+
+	err := schema.VisitJSON([]interface{}{map[string]interface{}{"title": "NDVI", "id": "a1"}}, openapi3.VisitAsRequest())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Property 'id' is read-only")
+}
+
+func TestSampleGeneratorReadOnlyWriteOnly(t *testing.T) {
+	schema := newJobSchema()
+	schema.Required = []string{"id", "plan"}
+
+	generator := openapi3.NewSampleGenerator(1)
+	generator.ValidationOptions = []openapi3.SchemaValidationOption{openapi3.VisitAsRequest()}
+	value, err := generator.Generate(schema)
+	require.NoError(t, err)
+	require.NotContains(t, value, "id")
+	require.NotContains(t, value, "status")
+	require.Contains(t, value, "plan")
+
+	generator.ValidationOptions = []openapi3.SchemaValidationOption{openapi3.VisitAsResponse()}
+	value, err = generator.Generate(schema)
+	require.NoError(t, err)
+	require.Contains(t, value, "id")
+	require.NotContains(t, value, "plan")
+}
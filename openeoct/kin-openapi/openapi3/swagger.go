@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/jsoninfo"
 )
@@ -28,6 +29,11 @@ func (swagger *Swagger) UnmarshalJSON(data []byte) error {
 	return jsoninfo.UnmarshalStrictStruct(data, swagger)
 }
 
+// IsOpenAPI31 returns whether the document is an OpenAPI 3.1 document, whose schemas are JSON Schema 2020-12
+func (swagger *Swagger) IsOpenAPI31() bool {
+	return strings.HasPrefix(swagger.OpenAPI, "3.1")
+}
+
 func (swagger *Swagger) AddOperation(path string, method string, operation *Operation) {
 	paths := swagger.Paths
 	if paths == nil {
@@ -77,7 +83,8 @@ func (swagger *Swagger) Validate(c context.Context) error {
 			if err := v.Validate(c); err != nil {
 				return wrap(err)
 			}
-		} else {
+		} else if !swagger.IsOpenAPI31() {
+			// Paths are optional in OpenAPI 3.1
 			return wrap(errors.New("must be a JSON object"))
 		}
 	}
@@ -34,6 +34,8 @@ type SwaggerLoader struct {
 	LoadSwaggerFromURIFunc func(loader *SwaggerLoader, url *url.URL) (*Swagger, error)
 	visited                map[interface{}]struct{}
 	visitedFiles           map[string]struct{}
+	// Whether the schemas are JSON Schema 2020-12, as in OpenAPI 3.1 documents
+	jsonSchema2020 bool
 }
 
 func NewSwaggerLoader() *SwaggerLoader {
@@ -167,6 +169,12 @@ func (swaggerLoader *SwaggerLoader) loadSwaggerFromDataWithPathInternal(data []b
 
 func (swaggerLoader *SwaggerLoader) ResolveRefsIn(swagger *Swagger, path *url.URL) (err error) {
 	swaggerLoader.visited = make(map[interface{}]struct{})
+
+	// The version of referenced documents does not change the one of the referencing document
+	defer func(jsonSchema2020 bool) {
+		swaggerLoader.jsonSchema2020 = jsonSchema2020
+	}(swaggerLoader.jsonSchema2020)
+	swaggerLoader.jsonSchema2020 = swagger.IsOpenAPI31()
 	if swaggerLoader.visitedFiles == nil {
 		swaggerLoader.visitedFiles = make(map[string]struct{})
 	}
@@ -609,7 +617,7 @@ func (swaggerLoader *SwaggerLoader) resolveSchemaRef(swagger *Swagger, component
 			if err := swaggerLoader.loadSingleElementFromURI(ref, documentPath, &schema); err != nil {
 				return err
 			}
-			component.Value = &schema
+			component.Value = swaggerLoader.withSiblings(component, &schema)
 		} else {
 			untypedResolved, componentPath, err := swaggerLoader.resolveComponent(swagger, ref, documentPath)
 			if err != nil {
@@ -623,7 +631,7 @@ func (swaggerLoader *SwaggerLoader) resolveSchemaRef(swagger *Swagger, component
 			if err := swaggerLoader.resolveSchemaRef(swagger, resolved, componentPath); err != nil {
 				return err
 			}
-			component.Value = resolved.Value
+			component.Value = swaggerLoader.withSiblings(component, resolved.Value)
 		}
 	}
 
@@ -636,6 +644,9 @@ func (swaggerLoader *SwaggerLoader) resolveSchemaRef(swagger *Swagger, component
 	if value == nil {
 		return nil
 	}
+	if swaggerLoader.jsonSchema2020 {
+		value.JSONSchema2020 = true
+	}
 
 	// ResolveRefs referred schemas
 	if v := value.Items; v != nil {
@@ -673,10 +684,26 @@ func (swaggerLoader *SwaggerLoader) resolveSchemaRef(swagger *Swagger, component
 			return err
 		}
 	}
+	for _, v := range value.subSchemas2020() {
+		if err := swaggerLoader.resolveSchemaRef(swagger, v, refDocumentPath); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// withSiblings returns the referenced schema combined with the keywords next to the reference,
+// which apply in addition to the referenced schema in OpenAPI 3.1 and are ignored otherwise.
+func (swaggerLoader *SwaggerLoader) withSiblings(component *SchemaRef, referenced *Schema) *Schema {
+	if !swaggerLoader.jsonSchema2020 || component.siblings == nil {
+		return referenced
+	}
+	schema := *component.siblings
+	schema.AllOf = append([]*SchemaRef{{Ref: component.Ref, Value: referenced}}, schema.AllOf...)
+	return &schema
+}
+
 func (swaggerLoader *SwaggerLoader) resolveSecuritySchemeRef(swagger *Swagger, component *SecuritySchemeRef, path *url.URL) error {
 	visited := swaggerLoader.visited
 	if _, isVisited := visited[component]; isVisited {
@@ -2,6 +2,8 @@ package openapi3filter
 
 import (
 	"context"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
 )
 
 var DefaultOptions = &Options{}
@@ -11,4 +13,14 @@ type Options struct {
 	ExcludeResponseBody   bool
 	IncludeResponseStatus bool
 	AuthenticationFunc    func(c context.Context, input *AuthenticationInput) error
+	// SchemaOptions are passed to the validation of parameters and bodies, e.g. the handling of formats
+	SchemaOptions []openapi3.SchemaValidationOption
+}
+
+// schemaOptions returns the options of the validation of a value against its schema
+func (options *Options) schemaOptions(opts ...openapi3.SchemaValidationOption) []openapi3.SchemaValidationOption {
+	if options == nil {
+		return opts
+	}
+	return append(append([]openapi3.SchemaValidationOption(nil), options.SchemaOptions...), opts...)
 }
@@ -121,7 +121,7 @@ func ValidateParameter(c context.Context, input *RequestValidationInput, paramet
 		// A parameter's schema is not defined so skip validation of a parameter's value.
 		return nil
 	}
-	if err = schema.VisitJSON(value); err != nil {
+	if err = schema.VisitJSON(value, input.Options.schemaOptions()...); err != nil {
 		return &RequestError{Input: input, Parameter: parameter, Err: err}
 	}
 	return nil
@@ -192,7 +192,7 @@ func ValidateRequestBody(c context.Context, input *RequestValidationInput, reque
 	}
 
 	// Validate JSON with the schema
-	if err := contentType.Schema.Value.VisitJSON(value); err != nil {
+	if err := contentType.Schema.Value.VisitJSON(value, input.Options.schemaOptions(openapi3.VisitAsRequest())...); err != nil {
 		return &RequestError{
 			Input:       input,
 			RequestBody: requestBody,
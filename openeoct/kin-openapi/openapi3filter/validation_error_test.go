@@ -655,3 +655,114 @@ func TestValidationHandler_Middleware(t *testing.T) {
 		require.Equal(t, "[422][][] Field must be set to array or not be present [source pointer=/photoUrls]", string(body))
 	})
 }
+
+type responseHandler struct {
+	Body string
+}
+
+func (h *responseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Test", "value")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(h.Body))
+}
+
+type streamingHandler struct {
+	Flushed bool
+}
+
+func (h *streamingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if flusher, ok := w.(http.Flusher); ok {
+		w.Write([]byte(`[]`))
+		flusher.Flush()
+		h.Flushed = true
+	}
+}
+
+func TestValidationHandler_validateResponse(t *testing.T) {
+	validBody := `[{"name":"Bahama","photoUrls":[]}]`
+	invalidBody := `{"name":"Bahama"}`
+
+	runTest := func(t *testing.T, h *ValidationHandler) *http.Response {
+		h.SwaggerFile = "fixtures/petstore.json"
+		require.NoError(t, h.Load())
+		// The router matches the path without the server prefix
+		r, err := http.NewRequest(http.MethodGet, "http://petstore.swagger.io/pet/findByStatus?status=sold", nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.Middleware(h.Handler).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("passes valid responses through", func(t *testing.T) {
+		encoder := &mockErrorEncoder{}
+		resp := runTest(t, &ValidationHandler{
+			Handler:              &responseHandler{Body: validBody},
+			ValidateResponses:    true,
+			ResponseErrorEncoder: encoder.Encode,
+		})
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.False(t, encoder.Called)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "value", resp.Header.Get("X-Test"))
+		require.Equal(t, validBody, string(body))
+	})
+
+	t.Run("uses response error encoder", func(t *testing.T) {
+		resp := runTest(t, &ValidationHandler{
+			Handler:              &responseHandler{Body: invalidBody},
+			ValidateResponses:    true,
+			ResponseErrorEncoder: DefaultErrorEncoder,
+		})
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("X-Test"))
+		require.Contains(t, string(body), "response body doesn't match the schema")
+	})
+
+	t.Run("calls response error hook", func(t *testing.T) {
+		var hookErr error
+		var hookInput *ResponseValidationInput
+		resp := runTest(t, &ValidationHandler{
+			Handler:           &responseHandler{Body: invalidBody},
+			ValidateResponses: true,
+			ResponseErrorHook: func(ctx context.Context, err error, input *ResponseValidationInput) {
+				hookErr = err
+				hookInput = input
+			},
+		})
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.IsType(t, &ResponseError{}, hookErr)
+		require.Equal(t, http.StatusOK, hookInput.Status)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, invalidBody, string(body))
+	})
+
+	t.Run("streams responses without response validation", func(t *testing.T) {
+		handler := &streamingHandler{}
+		resp := runTest(t, &ValidationHandler{
+			Handler: handler,
+		})
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.True(t, handler.Flushed)
+		require.Equal(t, `[]`, string(body))
+	})
+
+	t.Run("buffers responses with response validation", func(t *testing.T) {
+		handler := &streamingHandler{}
+		runTest(t, &ValidationHandler{
+			Handler:           handler,
+			ValidateResponses: true,
+		})
+
+		require.False(t, handler.Flushed)
+	})
+}
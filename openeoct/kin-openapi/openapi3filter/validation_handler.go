@@ -1,7 +1,9 @@
 package openapi3filter
 
 import (
+	"bytes"
 	"context"
+	"log"
 	"net/http"
 )
 
@@ -11,12 +13,23 @@ func NoopAuthenticationFunc(context.Context, *AuthenticationInput) error { retur
 
 var _ AuthenticationFunc = NoopAuthenticationFunc
 
+// ResponseErrorHook is called with the violations of responses, which are sent to the client unchanged.
+type ResponseErrorHook func(ctx context.Context, err error, input *ResponseValidationInput)
+
 type ValidationHandler struct {
 	Handler            http.Handler
 	AuthenticationFunc AuthenticationFunc
 	SwaggerFile        string
 	ErrorEncoder       ErrorEncoder
-	router             *Router
+	// ValidateResponses buffers the responses of the handler and validates them before
+	// sending them to the client. Responses are streamed if it is disabled.
+	ValidateResponses bool
+	// ResponseErrorEncoder replaces invalid responses with the encoded violation.
+	ResponseErrorEncoder ErrorEncoder
+	// ResponseErrorHook is called with violations of responses if no ResponseErrorEncoder is set.
+	// Violations are logged if neither is set.
+	ResponseErrorHook ResponseErrorHook
+	router            *Router
 }
 
 func (h *ValidationHandler) Load() error {
@@ -41,37 +54,65 @@ func (h *ValidationHandler) Load() error {
 }
 
 func (h *ValidationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if handled := h.before(w, r); handled {
-		return
-	}
-	// TODO: validateResponse
-	h.Handler.ServeHTTP(w, r)
+	h.serve(w, r, h.Handler)
 }
 
 // Middleware implements gorilla/mux MiddlewareFunc
 func (h *ValidationHandler) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if handled := h.before(w, r); handled {
-			return
-		}
-		// TODO: validateResponse
-		next.ServeHTTP(w, r)
+		h.serve(w, r, next)
 	})
 }
 
-func (h *ValidationHandler) before(w http.ResponseWriter, r *http.Request) (handled bool) {
-	if err := h.validateRequest(r); err != nil {
+func (h *ValidationHandler) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	input, err := h.requestValidationInput(r)
+	if err != nil {
 		h.ErrorEncoder(r.Context(), err, w)
-		return true
+		return
 	}
-	return false
+
+	if !h.ValidateResponses {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := newResponseRecorder()
+	next.ServeHTTP(recorder, r)
+
+	responseValidationInput := &ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.status,
+		Header:                 recorder.header,
+		Options:                input.Options,
+	}
+	responseValidationInput.SetBodyBytes(recorder.body.Bytes())
+
+	if err := ValidateResponse(r.Context(), responseValidationInput); err != nil {
+		if h.ResponseErrorEncoder != nil {
+			h.ResponseErrorEncoder(r.Context(), err, w)
+			return
+		}
+		if h.ResponseErrorHook != nil {
+			h.ResponseErrorHook(r.Context(), err, responseValidationInput)
+		} else {
+			log.Printf("Invalid response for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
+
+	recorder.writeTo(w)
 }
 
 func (h *ValidationHandler) validateRequest(r *http.Request) error {
+	_, err := h.requestValidationInput(r)
+	return err
+}
+
+// requestValidationInput validates the request and returns the input for the validation of its response.
+func (h *ValidationHandler) requestValidationInput(r *http.Request) (*RequestValidationInput, error) {
 	// Find route
 	route, pathParams, err := h.router.FindRoute(r.Method, r.URL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	options := &Options{
@@ -86,8 +127,47 @@ func (h *ValidationHandler) validateRequest(r *http.Request) error {
 		Options:    options,
 	}
 	if err = ValidateRequest(r.Context(), requestValidationInput); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return requestValidationInput, nil
+}
+
+// responseRecorder buffers the status, headers and body written by a handler,
+// so that the response can be validated before it is sent.
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(data)
+}
+
+// writeTo sends the buffered response.
+func (rec *responseRecorder) writeTo(w http.ResponseWriter) {
+	for name, values := range rec.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
 }
@@ -449,6 +449,72 @@ func TestValidateRequestBody(t *testing.T) {
 	}
 }
 
+func TestValidateReadOnlyWriteOnly(t *testing.T) {
+	id := openapi3.NewStringSchema()
+	id.ReadOnly = true
+	plan := openapi3.NewStringSchema()
+	plan.WriteOnly = true
+	job := openapi3.NewObjectSchema().
+		WithProperty("id", id).
+		WithProperty("plan", plan)
+	job.Required = []string{"id", "plan"}
+
+	body := openapi3.NewRequestBody().WithJSONSchema(job).WithRequired(true)
+	validateRequest := func(data interface{}) error {
+		req := httptest.NewRequest(http.MethodPost, "/jobs", toJSON(data))
+		req.Header.Set("Content-Type", "application/json")
+		return openapi3filter.ValidateRequestBody(context.Background(), &openapi3filter.RequestValidationInput{Request: req}, body)
+	}
+	require.NoError(t, validateRequest(map[string]interface{}{"plan": "free"}))
+	err := validateRequest(map[string]interface{}{"id": "a1", "plan": "free"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Property 'id' is read-only")
+
+	operation := openapi3.NewOperation()
+	operation.AddResponse(http.StatusOK, openapi3.NewResponse().WithJSONSchema(job))
+	validateResponse := func(data interface{}) error {
+		input := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{
+				Request: httptest.NewRequest(http.MethodGet, "/jobs/a1", nil),
+				Route:   &openapi3filter.Route{Operation: operation},
+			},
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+		}
+		value, err := json.Marshal(data)
+		require.NoError(t, err)
+		input.SetBodyBytes(value)
+		return openapi3filter.ValidateResponse(context.Background(), input)
+	}
+	require.NoError(t, validateResponse(map[string]interface{}{"id": "a1"}))
+	err = validateResponse(map[string]interface{}{"id": "a1", "plan": "free"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Property 'plan' is write-only")
+}
+
+func TestValidateSchemaOptions(t *testing.T) {
+	link := openapi3.NewObjectSchema().WithProperty("href", openapi3.NewStringSchema().WithFormat("url"))
+	body := openapi3.NewRequestBody().WithJSONSchema(link)
+
+	validate := func(options *openapi3filter.Options) error {
+		req := httptest.NewRequest(http.MethodPost, "/links", toJSON(map[string]interface{}{"href": "openeo.org"}))
+		req.Header.Set("Content-Type", "application/json")
+		return openapi3filter.ValidateRequestBody(context.Background(), &openapi3filter.RequestValidationInput{Request: req, Options: options}, body)
+	}
+	require.Error(t, validate(nil))
+	require.Error(t, validate(&openapi3filter.Options{}))
+
+	var warnings []string
+	err := validate(&openapi3filter.Options{SchemaOptions: []openapi3.SchemaValidationOption{
+		openapi3.FormatMode(openapi3.FormatWarn),
+		openapi3.FormatWarnings(func(err *openapi3.SchemaError) {
+			warnings = append(warnings, strings.Join(err.JSONPointer(), "/"))
+		}),
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"href"}, warnings)
+}
+
 func matchReqBodyError(want, got error) bool {
 	if want == got {
 		return true
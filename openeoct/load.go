@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Upper bounds in milliseconds of the buckets of the latency histograms, the last bucket is unbounded
+var LOAD_BUCKETS = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Maximum number of schema violations listed in the load report
+const LOAD_MAX_VIOLATIONS = 20
+
+// LoadBucket "class", a bucket of a latency histogram with the number of requests up to its bound in milliseconds
+type LoadBucket struct {
+	Le    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// LoadLatency "class", the distribution of the durations of requests in milliseconds
+type LoadLatency struct {
+	Min       float64      `json:"min"`
+	Mean      float64      `json:"mean"`
+	P50       float64      `json:"p50"`
+	P90       float64      `json:"p90"`
+	P95       float64      `json:"p95"`
+	P99       float64      `json:"p99"`
+	Max       float64      `json:"max"`
+	Histogram []LoadBucket `json:"histogram"`
+}
+
+// LoadStats "class", the statistics of the requests to an endpoint or to all endpoints.
+// Requests failing or answered with a status code of 400 or above are errors.
+type LoadStats struct {
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	ErrorRate  float64        `json:"error_rate"`
+	Throughput float64        `json:"throughput"`
+	Status     map[string]int `json:"status"`
+	Sampled    int            `json:"sampled"`
+	Violations int            `json:"violations"`
+	Latency    LoadLatency    `json:"latency"`
+
+	durations []float64
+}
+
+// LoadInterval "class", the requests started within an interval of the run, to follow the back end over time
+type LoadInterval struct {
+	Start    float64 `json:"start"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	P95      float64 `json:"p95"`
+
+	durations []float64
+}
+
+// LoadViolation "class", a sampled response not valid against the openEO API
+type LoadViolation struct {
+	Time    float64 `json:"time"`
+	Id      string  `json:"id"`
+	Url     string  `json:"url"`
+	Type    string  `json:"type"`
+	State   string  `json:"state"`
+	Message string  `json:"message"`
+}
+
+// LoadReport "class", the result of a load test. Times are given in seconds since the start of the run.
+type LoadReport struct {
+	Backend     string                `json:"backend"`
+	Start       string                `json:"start"`
+	End         string                `json:"end"`
+	Duration    float64               `json:"duration"`
+	Concurrency int                   `json:"concurrency"`
+	Rate        float64               `json:"rate"`
+	Sample      float64               `json:"sample"`
+	Total       *LoadStats            `json:"total"`
+	Endpoints   map[string]*LoadStats `json:"endpoints"`
+	Intervals   []*LoadInterval       `json:"intervals"`
+	Violations  []LoadViolation       `json:"violations"`
+	// States of the cleanup requests after the load test, keyed by endpoint id or method and path
+	Cleanup map[string](map[string]string) `json:"cleanup,omitempty"`
+}
+
+// LoadTest "class", sends the configured endpoints repeatedly to the back end and collects the statistics
+type LoadTest struct {
+	ct          *ComplianceTest
+	endpoints   []Endpoint
+	duration    time.Duration
+	rate        float64
+	concurrency int
+	sample      float64
+	interval    time.Duration
+	seed        int64
+	// Send the endpoints changing data at the back end, e.g. POST /jobs, not only GET endpoints
+	mutating bool
+
+	start  time.Time
+	report LoadReport
+	mutex  sync.Mutex
+	// Validation of the sampled responses is done one at a time
+	validation sync.Mutex
+}
+
+// Returns the load command, which sends the endpoints of the config files at a rate or a concurrency
+// for a fixed duration and validates a sample of the responses
+func loadCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "load",
+		Usage:     "load test the back end with the endpoints of the config files",
+		ArgsUsage: "CONFIG_FILE...",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "duration",
+				Value: 60,
+				Usage: "duration of the load test in seconds",
+			},
+			&cli.Float64Flag{
+				Name:  "rate",
+				Usage: "target number of requests per second, 0 sends as many requests as the concurrency allows",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Value: 4,
+				Usage: "maximum number of requests sent at the same time",
+			},
+			&cli.Float64Flag{
+				Name:  "sample",
+				Value: 0.1,
+				Usage: "fraction between 0 and 1 of the responses validated against the openEO API",
+			},
+			&cli.IntFlag{
+				Name:  "interval",
+				Value: 10,
+				Usage: "length in seconds of the intervals the requests are additionally reported in",
+			},
+			&cli.Int64Flag{
+				Name:  "seed",
+				Value: 1,
+				Usage: "seed of the random choice of the validated responses",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "file the load report is written to",
+			},
+			&cli.BoolFlag{
+				Name:  "mutating",
+				Usage: "also send the POST, PUT, PATCH and DELETE endpoints, the created resources are deleted after the load test",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ct := new(ComplianceTest)
+			if err := ct.applyGlobalFlags(c); err != nil {
+				return err
+			}
+			if ct.format != "json" {
+				return fmt.Errorf("The load report is only available as JSON")
+			}
+			if c.Args().Len() == 0 {
+				return fmt.Errorf("No config file specified")
+			}
+			if c.Int("duration") <= 0 || c.Int("concurrency") <= 0 || c.Int("interval") <= 0 {
+				return fmt.Errorf("Duration, concurrency and interval must be positive")
+			}
+			if c.Float64("rate") < 0 {
+				return fmt.Errorf("Rate must not be negative")
+			}
+			if c.Float64("sample") < 0 || c.Float64("sample") > 1 {
+				return fmt.Errorf("Sample must be between 0 and 1")
+			}
+
+			// Keep a connection per concurrent request instead of reconnecting
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.MaxIdleConnsPerHost = c.Int("concurrency")
+			ct.backend.transport = transport
+
+			for i := 0; i < c.Args().Len(); i++ {
+				config, err := ReadConfig(c.Args().Get(i))
+				if err != nil {
+					return err
+				}
+				if err := ct.appendConfig(config); err != nil {
+					return err
+				}
+			}
+			if ct.backend.url == "" {
+				return fmt.Errorf("No backend url specified")
+			}
+
+			load := &LoadTest{
+				ct:          ct,
+				duration:    time.Duration(c.Int("duration")) * time.Second,
+				rate:        c.Float64("rate"),
+				concurrency: c.Int("concurrency"),
+				sample:      c.Float64("sample"),
+				interval:    time.Duration(c.Int("interval")) * time.Second,
+				seed:        c.Int64("seed"),
+				mutating:    c.Bool("mutating"),
+			}
+			ct.interruptOnSignal()
+			report, err := load.run()
+			if err != nil {
+				return err
+			}
+
+			jsonString, _ := json.MarshalIndent(report, "", "    ")
+			if c.String("output") != "" {
+				ioutil.WriteFile(c.String("output"), jsonString, 0644)
+			} else {
+				os.Stdout.Write(append(jsonString, '\n'))
+			}
+			// Like the validation, violations only fail the load test if invalid groups or warnings fail the run
+			failed := len(report.Violations) > 0 || !cleanupSucceeded(report.Cleanup)
+			if failed && (ct.failoninvalid || ct.failonwarnings) {
+				os.Exit(EXIT_INVALID)
+			}
+			return nil
+		},
+	}
+}
+
+// Authenticates and sends the endpoints round robin until the duration is over.
+// Returns the report of the load test
+func (load *LoadTest) run() (*LoadReport, error) {
+	ct := load.ct
+
+	if _, errLoad := ct.loadRouter(); errLoad != nil {
+		return nil, fmt.Errorf("%s", ct.mask(errLoad.toString()))
+	}
+	token, authentication_err := ct.authenticate()
+	if authentication_err != nil {
+		return nil, fmt.Errorf("%s", ct.mask(authentication_err.toString()))
+	}
+	ct.token = token
+
+	// Groups in alphabetical order, endpoints in their configured order
+	var groups []string
+	for group := range ct.endpoints {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		endpoints := ct.endpoints[group]
+		sort.Sort(ByOrder(endpoints))
+		for _, endpoint := range endpoints {
+			if !ct.checkCapability(endpoint) && !CAP_EXCEPTIONS[endpoint.Url] {
+				continue
+			}
+			if !load.mutating && endpoint.Request_type != "" && endpoint.Request_type != http.MethodGet {
+				continue
+			}
+			// Dependencies on other endpoints are not checked under load
+			if endpoint.When != "" {
+				if ok, err := ct.evaluateCondition(endpoint.When); err != nil || !ok {
+					continue
+				}
+			}
+			endpoint.loadVariablesToEndpoint(*ct)
+			// Variables are not set under load, e.g. the job_id of a job created by another endpoint
+			if GetStringInBetween(endpoint.Url, "{", "}") != "" {
+				continue
+			}
+			load.endpoints = append(load.endpoints, endpoint)
+		}
+	}
+	if len(load.endpoints) == 0 {
+		return nil, fmt.Errorf("No endpoint supported by the back end")
+	}
+	// All resources created under load are deleted afterwards
+	ct.autocleanup = true
+
+	load.start = time.Now()
+	load.report = LoadReport{
+		Backend:     ct.mask(ct.backend.url),
+		Start:       load.start.Format("2006-01-02 15:04:05"),
+		Concurrency: load.concurrency,
+		Rate:        load.rate,
+		Sample:      load.sample,
+		Total:       &LoadStats{Status: make(map[string]int)},
+		Endpoints:   make(map[string]*LoadStats),
+		Intervals:   []*LoadInterval{},
+		Violations:  []LoadViolation{},
+	}
+	log.Printf("Load testing %s with %d endpoints for %s\n", load.report.Backend, len(load.endpoints), load.duration)
+
+	// The requests are handed out by the dispatcher, at the target rate if set
+	requests := make(chan Endpoint)
+	var workers sync.WaitGroup
+	for i := 0; i < load.concurrency; i++ {
+		workers.Add(1)
+		go func(random *rand.Rand) {
+			defer workers.Done()
+			for endpoint := range requests {
+				load.send(endpoint, random)
+			}
+		}(rand.New(rand.NewSource(load.seed + int64(i))))
+	}
+
+	deadline := time.After(load.duration)
+	var interrupted <-chan struct{}
+	if ct.interrupt != nil {
+		interrupted = ct.interrupt.Done()
+	}
+	var ticks <-chan time.Time
+	if load.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / load.rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+dispatch:
+	for counter := 0; ; counter++ {
+		if ticks != nil {
+			select {
+			case <-ticks:
+			case <-deadline:
+				break dispatch
+			case <-interrupted:
+				break dispatch
+			}
+		}
+		select {
+		case requests <- load.endpoints[counter%len(load.endpoints)]:
+		case <-deadline:
+			break dispatch
+		case <-interrupted:
+			break dispatch
+		}
+	}
+
+	// Requests already sent are completed and counted
+	close(requests)
+	workers.Wait()
+	report := load.finish()
+	for id, state := range ct.runCleanup() {
+		if report.Cleanup == nil {
+			report.Cleanup = make(map[string](map[string]string))
+		}
+		report.Cleanup[ct.mask(id)] = ct.maskState(state)
+	}
+	return report, nil
+}
+
+// Sends a single request of an endpoint and validates the response if it is sampled
+func (load *LoadTest) send(endpoint Endpoint, random *rand.Rand) {
+	ct := load.ct
+	started := time.Since(load.start)
+
+	timeout := 30 * time.Second
+	if endpoint.Timeout != 0 {
+		timeout = time.Duration(endpoint.Timeout) * time.Second
+	}
+	client := ct.newClient(timeout)
+
+	execReq, errReq := ct.buildRequest(endpoint, ct.token, true)
+	if errReq != nil {
+		load.record(endpoint, started, 0, "error", nil)
+		return
+	}
+	if ct.interrupt != nil {
+		execReq = execReq.WithContext(ct.interrupt)
+	}
+	execReq, timing := traceRequest(execReq)
+	resp, err := client.Do(execReq)
+	if err != nil {
+		timing.finish(0)
+		load.record(endpoint, started, timing.Total, "error", nil)
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	timing.finish(len(body))
+	if err != nil {
+		load.record(endpoint, started, timing.Total, "error", nil)
+		return
+	}
+	if resp.StatusCode < 400 {
+		load.mutex.Lock()
+		ct.trackResource(execReq.Method, endpoint.Url, resp.Header)
+		load.mutex.Unlock()
+	}
+
+	var violation *LoadViolation
+	if random.Float64() < load.sample {
+		violation = &LoadViolation{}
+		httpReq, errReq := ct.buildRequest(endpoint, ct.token, false)
+		if errReq == nil {
+			load.validation.Lock()
+			state, errmsg := ct.validateExchange(endpoint, httpReq, resp, body, nil)
+			load.validation.Unlock()
+			violation.State = state
+			if errmsg != nil {
+				violation.Message = ct.mask(errmsg.toString())
+			}
+		}
+	}
+	load.record(endpoint, started, timing.Total, strconv.Itoa(resp.StatusCode), violation)
+}
+
+// Adds a request to the statistics. The status is the status code or "error" for failed requests,
+// the violation is nil if the response is not sampled and has the state of the validation otherwise
+func (load *LoadTest) record(endpoint Endpoint, started time.Duration, duration time.Duration, status string, violation *LoadViolation) {
+	load.mutex.Lock()
+	defer load.mutex.Unlock()
+
+	stats, ok := load.report.Endpoints[endpoint.Id]
+	if !ok {
+		stats = &LoadStats{Status: make(map[string]int)}
+		load.report.Endpoints[endpoint.Id] = stats
+	}
+
+	index := int(started / load.interval)
+	for len(load.report.Intervals) <= index {
+		start := float64(len(load.report.Intervals)) * load.interval.Seconds()
+		load.report.Intervals = append(load.report.Intervals, &LoadInterval{Start: start})
+	}
+	interval := load.report.Intervals[index]
+
+	failed := status == "error"
+	if code, err := strconv.Atoi(status); err == nil && code >= 400 {
+		failed = true
+	}
+	milliseconds := float64(duration) / float64(time.Millisecond)
+
+	for _, s := range []*LoadStats{stats, load.report.Total} {
+		s.Requests++
+		s.Status[status]++
+		s.durations = append(s.durations, milliseconds)
+		if failed {
+			s.Errors++
+		}
+		if violation != nil {
+			s.Sampled++
+			if violation.State == "Invalid" {
+				s.Violations++
+			}
+		}
+	}
+	interval.Requests++
+	interval.durations = append(interval.durations, milliseconds)
+	if failed {
+		interval.Errors++
+	}
+
+	if violation != nil && violation.State == "Invalid" && len(load.report.Violations) < LOAD_MAX_VIOLATIONS {
+		violation.Time = started.Seconds()
+		violation.Id = endpoint.Id
+		violation.Url = load.ct.mask(endpoint.Url)
+		violation.Type = endpoint.Request_type
+		load.report.Violations = append(load.report.Violations, *violation)
+		log.Println("Invalid:", endpoint.Id, violation.Url, violation.Message)
+	}
+}
+
+// Computes the rates and latency distributions after all requests are done
+func (load *LoadTest) finish() *LoadReport {
+	end := time.Now()
+	elapsed := end.Sub(load.start).Seconds()
+	load.report.End = end.Format("2006-01-02 15:04:05")
+	load.report.Duration = elapsed
+
+	for _, stats := range load.report.Endpoints {
+		stats.summarize(elapsed)
+	}
+	load.report.Total.summarize(elapsed)
+	for _, interval := range load.report.Intervals {
+		sort.Float64s(interval.durations)
+		interval.P95 = percentile(interval.durations, 95)
+	}
+	return &load.report
+}
+
+// Computes the error rate, the throughput in requests per second and the latency distribution
+func (stats *LoadStats) summarize(elapsed float64) {
+	if stats.Requests == 0 {
+		return
+	}
+	stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+	stats.Throughput = float64(stats.Requests) / elapsed
+
+	sort.Float64s(stats.durations)
+	sum := 0.0
+	for _, duration := range stats.durations {
+		sum += duration
+	}
+	stats.Latency = LoadLatency{
+		Min:  stats.durations[0],
+		Mean: sum / float64(len(stats.durations)),
+		P50:  percentile(stats.durations, 50),
+		P90:  percentile(stats.durations, 90),
+		P95:  percentile(stats.durations, 95),
+		P99:  percentile(stats.durations, 99),
+		Max:  stats.durations[len(stats.durations)-1],
+	}
+
+	// Cumulative buckets, like the histograms of Prometheus
+	for _, bound := range LOAD_BUCKETS {
+		count := sort.Search(len(stats.durations), func(i int) bool { return stats.durations[i] > bound })
+		stats.Latency.Histogram = append(stats.Latency.Histogram, LoadBucket{Le: strconv.FormatFloat(bound, 'f', -1, 64), Count: count})
+	}
+	stats.Latency.Histogram = append(stats.Latency.Histogram, LoadBucket{Le: "+Inf", Count: len(stats.durations)})
+}
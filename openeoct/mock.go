@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3filter"
+
+	"github.com/urfave/cli"
+)
+
+// Kinds of faults injected into the responses of the mock back end
+const (
+	FAULT_MISSING_PROPERTY = "missing-property"
+	FAULT_WRONG_TYPE       = "wrong-type"
+	FAULT_CONTENT_TYPE     = "content-type"
+)
+
+// Header of the mock back end naming the fault injected into the response
+const FAULT_HEADER = "X-Mock-Fault"
+
+// MockBackend "class", answers every operation of the openEO API with an example response
+type MockBackend struct {
+	router *openapi3filter.Router
+	// Probability of a response to be broken deliberately, between 0 and 1
+	faults float64
+	mutex  sync.Mutex
+	random *rand.Rand
+	// Generates the bodies and headers not given as examples
+	generator *openapi3.SampleGenerator
+}
+
+// Creates the command to run a mock back end generated from the openEO API
+func mockCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "mock",
+		Usage: "run a back end answering all operations of the openEO API with example responses",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "spec",
+				Usage: "file of the openEO API definition",
+			},
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: "localhost:8080",
+				Usage: "address the mock back end listens on",
+			},
+			&cli.Float64Flag{
+				Name:  "faults",
+				Usage: "probability between 0 and 1 of a response to be broken deliberately",
+			},
+			&cli.Int64Flag{
+				Name:  "seed",
+				Value: 1,
+				Usage: "seed of the generated responses and the random choice of broken responses",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.String("spec") == "" {
+				return fmt.Errorf("No openEO API definition specified")
+			}
+			if c.Float64("faults") < 0 || c.Float64("faults") > 1 {
+				return fmt.Errorf("Fault probability must be between 0 and 1")
+			}
+
+			handler, err := NewMockHandler(c.String("spec"), c.Float64("faults"), c.Int64("seed"))
+			if err != nil {
+				return err
+			}
+
+			log.Println("Mock back end listening on", c.String("listen"))
+			return http.ListenAndServe(c.String("listen"), handler)
+		},
+	}
+}
+
+// Creates the handler of a mock back end for the openEO API file. Requests are validated before
+// they are answered, invalid requests are answered with an openEO error.
+func NewMockHandler(spec string, faults float64, seed int64) (http.Handler, error) {
+	router := openapi3filter.NewRouter()
+	if err := router.AddSwaggerFromFile(spec); err != nil {
+		return nil, fmt.Errorf("Error reading the openEO API: %v", err)
+	}
+
+	mock := &MockBackend{
+		router: router,
+		faults: faults,
+		random: rand.New(rand.NewSource(seed)),
+	}
+	mock.generator = openapi3.NewSampleGenerator(seed)
+	mock.generator.UseExamples = true
+	mock.generator.ValidationOptions = []openapi3.SchemaValidationOption{openapi3.VisitAsResponse()}
+
+	validation := &openapi3filter.ValidationHandler{
+		Handler:      mock,
+		SwaggerFile:  spec,
+		ErrorEncoder: (&openapi3filter.ValidationErrorEncoder{Encoder: encodeMockError}).Encode,
+	}
+	if err := validation.Load(); err != nil {
+		return nil, err
+	}
+	return validation, nil
+}
+
+// Encodes errors as openEO error responses
+func encodeMockError(_ context.Context, err error, w http.ResponseWriter) {
+	status := http.StatusBadRequest
+	code := "BadRequest"
+	if validationErr, ok := err.(*openapi3filter.ValidationError); ok {
+		status = validationErr.StatusCode()
+		if status == http.StatusNotFound {
+			code = "NotFound"
+		}
+	}
+	writeJSON(w, status, map[string]string{"code": code, "message": err.Error()})
+}
+
+// Answers a validated request with the first successful response of its operation
+func (mock *MockBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, _, err := mock.router.FindRoute(r.Method, r.URL)
+	if err != nil {
+		encodeMockError(r.Context(), err, w)
+		return
+	}
+
+	status, response := mockResponse(route.Operation)
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	for name, header := range response.Headers {
+		if header.Value == nil {
+			continue
+		}
+		value := header.Value.Example
+		if value == nil && header.Value.Schema != nil {
+			value, _ = mock.generate(header.Value.Schema.Value)
+		}
+		if value != nil {
+			w.Header().Set(name, fmt.Sprint(value))
+		}
+	}
+
+	content_type, media := mockMediaType(response.Content)
+	if media == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	body, err := mock.body(media)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"code": "Internal", "message": err.Error()})
+		return
+	}
+
+	if fault := mock.injectFault(media.Schema, &body, &content_type); fault != "" {
+		w.Header().Set(FAULT_HEADER, fault)
+	}
+
+	data, _ := json.MarshalIndent(body, "", "    ")
+	w.Header().Set("Content-Type", content_type)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// Returns the first successful response of the operation, with the lowest status code.
+// Operations without successful response are answered with the default response.
+func mockResponse(operation *openapi3.Operation) (int, *openapi3.Response) {
+	var codes []int
+	for code := range operation.Responses {
+		if status, err := strconv.Atoi(code); err == nil && status >= 200 && status < 300 {
+			codes = append(codes, status)
+		}
+	}
+	sort.Ints(codes)
+
+	if len(codes) > 0 {
+		return codes[0], operation.Responses.Get(codes[0]).Value
+	}
+	if response := operation.Responses.Default(); response != nil {
+		return http.StatusOK, response.Value
+	}
+	return http.StatusNoContent, nil
+}
+
+// Returns the media type of the response, preferring JSON
+func mockMediaType(content openapi3.Content) (string, *openapi3.MediaType) {
+	if media, ok := content["application/json"]; ok {
+		return "application/json", media
+	}
+	var types []string
+	for content_type := range content {
+		types = append(types, content_type)
+	}
+	if len(types) == 0 {
+		return "", nil
+	}
+	sort.Strings(types)
+	return types[0], content[types[0]]
+}
+
+// Returns the body of a response: the example of the media type or the first of its examples,
+// sorted by name, or an instance generated from the schema. Examples not matching the schema are skipped,
+// so that the mock back end always complies.
+func (mock *MockBackend) body(media *openapi3.MediaType) (interface{}, error) {
+	examples := []interface{}{media.Example}
+	var names []string
+	for name := range media.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if example := media.Examples[name].Value; example != nil {
+			examples = append(examples, example.Value)
+		}
+	}
+
+	for _, example := range examples {
+		if example == nil {
+			continue
+		}
+		if media.Schema == nil || media.Schema.Value.VisitJSON(example, openapi3.VisitAsResponse()) == nil {
+			return example, nil
+		}
+	}
+
+	if media.Schema != nil {
+		return mock.generate(media.Schema.Value)
+	}
+	return nil, nil
+}
+
+// Generates an instance of the schema, the generator is shared by all requests
+func (mock *MockBackend) generate(schema *openapi3.Schema) (interface{}, error) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	return mock.generator.Generate(schema)
+}
+
+// Breaks the body or the content type of a response with the configured probability.
+// Returns the kind of the injected fault or an empty string.
+func (mock *MockBackend) injectFault(schema *openapi3.SchemaRef, body *interface{}, content_type *string) string {
+	if mock.faults == 0 || schema == nil {
+		return ""
+	}
+
+	mock.mutex.Lock()
+	broken := mock.random.Float64() < mock.faults
+	kind := mock.random.Intn(3)
+	mock.mutex.Unlock()
+
+	if !broken {
+		return ""
+	}
+
+	// The body may be an example of the openEO API, which must not be changed
+	data, _ := json.Marshal(*body)
+	json.Unmarshal(data, body)
+
+	switch kind {
+	case 0:
+		if removeRequiredProperty(schema.Value, *body) {
+			return FAULT_MISSING_PROPERTY
+		}
+	case 1:
+		if _, ok := (*body).(map[string]interface{}); ok {
+			*body = []interface{}{}
+		} else {
+			*body = map[string]interface{}{}
+		}
+		return FAULT_WRONG_TYPE
+	}
+
+	*content_type = "text/plain"
+	return FAULT_CONTENT_TYPE
+}
+
+// Removes the first required property of the first object with required properties
+func removeRequiredProperty(schema *openapi3.Schema, value interface{}) bool {
+	if schema == nil {
+		return false
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		required := append([]string{}, schema.Required...)
+		for _, sub := range schema.AllOf {
+			if sub.Value != nil {
+				required = append(required, sub.Value.Required...)
+			}
+		}
+		for _, name := range required {
+			if _, ok := v[name]; ok {
+				delete(v, name)
+				return true
+			}
+		}
+		for name, property := range schema.Properties {
+			if item, ok := v[name]; ok && removeRequiredProperty(property.Value, item) {
+				return true
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for _, item := range v {
+				if removeRequiredProperty(schema.Items.Value, item) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+)
+
+// Name of the report group containing the negative error handling tests
+const NEGATIVE_GROUP = "Error Handling"
+
+// Identifiers that are not expected to exist at any back end
+var NEGATIVE_IDS = []string{"openeoct-invalid-id", "00000000-0000-0000-0000-000000000000"}
+
+// NegativeTest "class", a request that has to be answered with an openEO error
+type NegativeTest struct {
+	Path   string
+	Method string
+	Auth   bool
+	Status int
+	Code   string
+}
+
+// Requests to resources that do not exist, the {id} is replaced with each of the NEGATIVE_IDS
+var NEGATIVE_NOT_FOUND = []NegativeTest{
+	{"/jobs/{id}", http.MethodGet, true, http.StatusNotFound, "JobNotFound"},
+	{"/services/{id}", http.MethodGet, true, http.StatusNotFound, "ServiceNotFound"},
+	{"/collections/{id}", http.MethodGet, false, http.StatusNotFound, "CollectionNotFound"},
+	{"/invalid/path/to/nowhere", http.MethodGet, false, http.StatusNotFound, "NotFound"},
+}
+
+// Validates the error handling of the back end with requests that have to fail:
+// unauthenticated requests to all operations that require authentication and requests to
+// resources that do not exist.
+// Returns a map of strings containing the states of the tests, keyed by test, method and path
+func (ct *ComplianceTest) validateErrorHandling() map[string](map[string]string) {
+
+	states := make(map[string](map[string]string))
+
+	_, errLoad := ct.loadRouter()
+
+	if errLoad != nil {
+		states["error handling"] = map[string]string{
+			"state":   "Error",
+			"message": errLoad.toString(),
+			"url":     "",
+			"type":    "",
+		}
+		return states
+	}
+
+	var tests []NegativeTest
+
+	// Unauthenticated requests
+	var spec_paths []string
+	for spec_path := range ct.swagger.Paths {
+		spec_paths = append(spec_paths, spec_path)
+	}
+	sort.Strings(spec_paths)
+
+	param := regexp.MustCompile(`{[^{}]*}`)
+	for _, spec_path := range spec_paths {
+		for method, operation := range ct.swagger.Paths[spec_path].Operations() {
+			if !requiresAuthentication(ct.swagger, operation) {
+				continue
+			}
+			tests = append(tests, NegativeTest{
+				Path:   param.ReplaceAllLiteralString(spec_path, NEGATIVE_IDS[0]),
+				Method: method,
+				Auth:   false,
+				Status: http.StatusUnauthorized,
+				Code:   "AuthenticationRequired",
+			})
+		}
+	}
+
+	// Requests to not existing resources
+	for _, test := range NEGATIVE_NOT_FOUND {
+		for _, id := range NEGATIVE_IDS {
+			id_test := test
+			id_test.Path = param.ReplaceAllLiteralString(test.Path, id)
+			tests = append(tests, id_test)
+			if id_test.Path == test.Path {
+				break
+			}
+		}
+	}
+
+	for _, test := range tests {
+		id := test.Method + " " + test.Path
+		if test.Status == http.StatusUnauthorized {
+			id = "unauthenticated " + id
+		} else {
+			id = "not found " + id
+		}
+
+		states[id] = map[string]string{
+			"state":   "Valid",
+			"message": "",
+			"url":     test.Path,
+			"type":    test.Method,
+		}
+
+		if !ct.checkCapability(Endpoint{Url: test.Path, Request_type: test.Method}) && test.Code != "NotFound" {
+			states[id]["state"] = "NotSupported"
+			states[id]["message"] = "Test skipped, endpoint not listed in backend capabilities"
+			continue
+		}
+
+		if test.Auth && ct.token == "" {
+			states[id]["state"] = "NotSupported"
+			states[id]["message"] = "Test skipped, requires the credentials of a user"
+			continue
+		}
+
+		state, err := ct.runNegativeTest(test)
+		states[id]["state"] = state
+		if err != nil {
+			states[id]["message"] = err.toString()
+		}
+	}
+
+	return states
+}
+
+// Checks if an operation requires authentication, either by its own security requirements
+// or by the global ones of the API definition.
+func requiresAuthentication(swagger *openapi3.Swagger, operation *openapi3.Operation) bool {
+	security := swagger.Security
+	if operation.Security != nil {
+		security = *operation.Security
+	}
+	if len(security) == 0 {
+		return false
+	}
+	for _, requirement := range security {
+		// An empty requirement makes authentication optional
+		if len(requirement) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Sends the request of a negative test and checks the response code and the openEO error code.
+// Returns the resulting state and an error message if the back end did not respond as expected.
+func (ct *ComplianceTest) runNegativeTest(test NegativeTest) (string, *ErrorMessage) {
+
+	client := ct.newClient(30 * time.Second)
+
+	httpReq, _ := http.NewRequest(test.Method, build_url(ct.backend.url, test.Path), nil)
+	if test.Auth {
+		setBearer(httpReq, ct.token)
+	}
+
+	resp, err := client.Do(httpReq)
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = test.Method + "  " + test.Path
+		errormsg.msg = "Error sending request to back end"
+		errormsg.output = string(err.Error())
+		return "Error", errormsg
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// Protected paths that are not implemented can not be tested
+	if test.Status == http.StatusUnauthorized && resp.StatusCode == http.StatusNotFound {
+		errormsg := new(ErrorMessage)
+		errormsg.input = test.Method + "  " + test.Path
+		errormsg.msg = "Test skipped, path not found at the back end"
+		errormsg.output = ""
+		return "NotSupported", errormsg
+	}
+
+	if resp.StatusCode != test.Status {
+		errormsg := new(ErrorMessage)
+		errormsg.input = test.Method + "  " + test.Path
+		errormsg.msg = "Response Code " + strconv.Itoa(resp.StatusCode) + " instead of " + strconv.Itoa(test.Status)
+		errormsg.output = string(body)
+		return "Invalid", errormsg
+	}
+
+	var openeo_error map[string]interface{}
+	if err := json.Unmarshal(body, &openeo_error); err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = test.Method + "  " + test.Path
+		errormsg.msg = "Response is not a JSON openEO error"
+		errormsg.output = string(body)
+		return "Invalid", errormsg
+	}
+
+	code, _ := openeo_error["code"].(string)
+	_, has_message := openeo_error["message"].(string)
+	if code != test.Code || !has_message {
+		errormsg := new(ErrorMessage)
+		errormsg.input = test.Method + "  " + test.Path
+		errormsg.msg = "Expected openEO error with code " + test.Code + " and a message"
+		errormsg.output = string(body)
+		return "Invalid", errormsg
+	}
+
+	return warningState(test.Method+"  "+test.Path, checkWarnings(WarningResponse{
+		Method: test.Method,
+		Path:   test.Path,
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   body}))
+}
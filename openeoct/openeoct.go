@@ -4,8 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-
-	//"fmt"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -38,6 +37,8 @@ type BackEnd struct {
 	url     string
 	baseurl string
 	version string
+	// Transport used for the requests to the back end, nil for the default transport
+	transport http.RoundTripper
 
 	// Add auth and that stuff
 }
@@ -70,6 +71,14 @@ type Endpoint struct {
 	Wait         int
 	RetryCode    string
 	Order        int
+	// Rules on the response beyond the schema validation
+	Assert []Assertion
+	// Latency budget in seconds, 0 for no budget
+	Max_duration float64
+	// Ids of the endpoints that have to be valid for the endpoint to be validated
+	Depends_on []string
+	// Expression on the back end and the variables that has to be true for the endpoint to be validated
+	When string
 	// Add auth and that stuff
 }
 
@@ -101,23 +110,95 @@ type ComplianceTest struct {
 	username     string
 	password     string
 	output       string
+	history      string
+	format       string
 	debug        bool
 	router       *openapi3filter.Router
+	swagger      *openapi3.Swagger
 	capabilities Capability
+	// Capabilities as advertised by the back end, before converting the paths to regular expressions
+	advertised        Capability
+	capabilitiesaudit bool
+	cors              bool
+	negativetests     bool
+	fuzz              bool
+	// Limits and seed of the fuzzing, defaults are used for 0
+	fuzzrequests int
+	fuzzduration int
+	fuzzseed     int64
+	// Handling of the formats of strings in requests and responses, lenient if not configured
+	formats openapi3.FormatValidationMode
+	// Exit with EXIT_INVALID if a group is invalid
+	failoninvalid bool
+	// Exit with EXIT_WARNING if a group has warnings, and with EXIT_INVALID if a group is invalid
+	failonwarnings bool
+	// Endpoints exceeding their max_duration are invalid instead of having a warning
+	failonbudget bool
+	// Access token of the authenticated user, set during the validation
+	token string
+	// Documents of the back end requested for when expressions, nil if not available
+	documents map[string]interface{}
+	// Called after every validated endpoint
+	progress func(endpoint Endpoint, state map[string]string)
+	// Requests and responses of the validated endpoints, keyed by endpoint id
+	exchanges map[string]*Exchange
+	// Names of the variables containing secrets, which are masked like credentials
+	secrets []string
+	// Disables masking of credentials and secrets in logs and reports
+	nomask bool
+	// Endpoints run at the end of the run to delete the resources created by it
+	cleanup []Endpoint
+	// Delete the resources created by the endpoints at the end of the run
+	autocleanup bool
+	// Paths of the resources created by the endpoints and not deleted yet, in order of creation
+	resources []string
+	// Canceled if the run is interrupted, nil if the run can not be interrupted
+	interrupt context.Context
+	// Only bodies given inline as JSON are sent, also after loading the variables. Set for the runs of
+	// the server, as posted configs must not read files of the server.
+	inlinebodies bool
 }
 
+// Report "class", containing the results per group and the stats of the run
+type Report map[string](map[string](map[string]interface{}))
+
 // Elements of the Config file
 type Config struct {
-	Url            string
-	Openapi        string
-	Username       string
-	Password       string
-	Authurl        string
-	Endpoints      map[string]Endpoint
-	Output         string
-	Config         string
-	Variables      map[string]string
-	Backendversion string
+	Url               string
+	Openapi           string
+	Username          string
+	Password          string
+	Authurl           string
+	Endpoints         map[string]Endpoint
+	Output            string
+	History           string
+	Config            string
+	Variables         map[string]string
+	Secrets           []string
+	Backendversion    string
+	Capabilitiesaudit bool
+	Cors              bool
+	Negativetests     bool
+	Fuzz              bool
+	Fuzzrequests      int
+	Fuzzduration      int
+	Fuzzseed          int64
+	Formats           string
+	Failoninvalid     bool
+	Failonwarnings    bool
+	Failonbudget      bool
+	Cleanup           map[string]Endpoint
+	Autocleanup       bool
+}
+
+// Exit code if at least one group of the report is invalid (1 is used for errors of the tool itself)
+const EXIT_INVALID = 2
+
+// Handlings of the formats of strings, by their names in the config file
+var FORMAT_MODES = map[string]openapi3.FormatValidationMode{
+	"strict":  openapi3.FormatStrict,
+	"lenient": openapi3.FormatLenient,
+	"warn":    openapi3.FormatWarn,
 }
 
 var CAP_EXCEPTIONS = map[string]bool{
@@ -132,11 +213,23 @@ func build_url(base string, ep string) string {
 	return u.String()
 }
 
-// Validates all enpoints defined in the compliance test instance.
-// Returns a map of strings containing the states of the validation results
-func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorMessage) {
+// Creates a HTTP client using the transport of the back end, which records or replays the requests if set.
+// A timeout of 0 means no timeout.
+func (ct *ComplianceTest) newClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: ct.backend.transport}
+}
 
-	states := make(map[string](map[string]string))
+// Passes the state of a validated endpoint to the progress function, if one is set
+func (ct *ComplianceTest) reportProgress(endpoint Endpoint, state map[string]string) {
+	if ct.progress != nil {
+		endpoint.Url = ct.mask(endpoint.Url)
+		ct.progress(endpoint, ct.maskState(state))
+	}
+}
+
+// Requests the access token from the authentication endpoint, if credentials are given in the config.
+// Returns the token (empty if no credentials are given) and an error message if the authentication failed
+func (ct *ComplianceTest) authenticate() (string, *ErrorMessage) {
 
 	token := ""
 
@@ -145,7 +238,7 @@ func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorM
 	// Set Authentication Token
 	if ct.username != "" && ct.password != "" && ct.authendpoint != "" {
 
-		client := &http.Client{}
+		client := ct.newClient(0)
 
 		httpReq, _ := http.NewRequest(http.MethodGet, build_url(ct.backend.url, ct.authendpoint), nil)
 		httpReq.SetBasicAuth(ct.username, ct.password)
@@ -171,16 +264,40 @@ func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorM
 		authentication_err = nil
 	}
 
-	for _, endpoints := range ct.endpoints {
+	return token, authentication_err
+}
+
+// Validates all enpoints defined in the compliance test instance.
+// Returns a map of strings containing the states of the validation results
+func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorMessage) {
+
+	states := make(map[string](map[string]string))
+
+	token, authentication_err := ct.authenticate()
+	ct.token = token
+
+	for _, group := range ct.groupOrder() {
+		endpoints := ct.endpoints[group]
 		//Sorting within the group
 		sort.Sort(ByOrder(endpoints))
 
 		for _, endpoint := range endpoints {
+			if ct.interrupted() {
+				states[endpoint.Id] = map[string]string{"state": "NotSupported", "message": "Endpoint skipped, run interrupted"}
+				ct.reportProgress(endpoint, states[endpoint.Id])
+				continue
+			}
 			if (ct.checkCapability(endpoint) == false) && (!CAP_EXCEPTIONS[endpoint.Url]) {
 				states[endpoint.Id] = make(map[string]string)
 				states[endpoint.Id]["message"] = "Endpoint skipped, not listed in backend capabilities"
 				states[endpoint.Id]["state"] = "NotSupported"
 				//log.Println("Endpoint missing: " + endpoint.Id)
+				ct.reportProgress(endpoint, states[endpoint.Id])
+				continue
+			}
+			if state, message := ct.checkConditions(endpoint, states); state != "" {
+				states[endpoint.Id] = map[string]string{"state": state, "message": message}
+				ct.reportProgress(endpoint, states[endpoint.Id])
 				continue
 			}
 			//log.Println("Group: " + group + ", Endpoint: " + endpoint.Id)
@@ -189,7 +306,7 @@ func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorM
 			state, err := ct.validate(endpoint, token)
 			if state == "Retry" {
 
-				for counter < 10 {
+				for counter < 10 && !ct.interrupted() {
 
 					state, err = ct.validate(endpoint, token)
 					if state != "Retry" {
@@ -202,8 +319,11 @@ func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorM
 			states[endpoint.Id] = make(map[string]string)
 			states[endpoint.Id]["state"] = state
 
-			if err != nil {
-				if endpoint.Optional == false {
+			if ct.interrupted() && !isPassing(state) {
+				states[endpoint.Id]["state"] = "NotSupported"
+				states[endpoint.Id]["message"] = "Endpoint interrupted"
+			} else if err != nil {
+				if endpoint.Optional == false || state == "Warning" {
 					states[endpoint.Id]["message"] = err.toString()
 				} else {
 					states[endpoint.Id]["message"] = "Non-mandatory endpoint, not supported by back-end"
@@ -212,6 +332,7 @@ func (ct *ComplianceTest) validateAll() (map[string](map[string]string), *ErrorM
 			} else {
 				states[endpoint.Id]["message"] = ""
 			}
+			ct.reportProgress(endpoint, states[endpoint.Id])
 			time.Sleep(time.Duration(endpoint.Wait) * time.Second)
 		}
 	}
@@ -238,6 +359,7 @@ func (ep *Endpoint) loadVariablesToEndpoint(ct ComplianceTest) {
 	ep.Id = loadVariable(ep.Id, ct.variables)
 	ep.Request_type = loadVariable(ep.Request_type, ct.variables)
 	ep.Url = loadVariable(ep.Url, ct.variables)
+	ep.Assert = loadVariablesToAssertions(ep.Assert, ct.variables)
 
 }
 
@@ -251,6 +373,13 @@ func (err *ErrorMessage) toString() string {
 	return "Input: " + err.input + "; Error: " + err.msg + "; Details: " + err.output
 }
 
+// Adds the openEO bearer token of the basic authentication to the request, if a token is given
+func setBearer(httpReq *http.Request, token string) {
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer basic//"+token)
+	}
+}
+
 func (ct *ComplianceTest) buildRequest(endpoint Endpoint, token string, abs_url bool) (*http.Request, *ErrorMessage) {
 
 	method := http.MethodGet
@@ -276,12 +405,20 @@ func (ct *ComplianceTest) buildRequest(endpoint Endpoint, token string, abs_url
 		}
 	}
 
-	if token != "" {
-		bearer := "Bearer basic//" + token
-		httpReq.Header.Add("Authorization", bearer)
-	}
+	setBearer(httpReq, token)
+
+	if isInlineBody(endpoint.Body) {
+		httpReq.Body = ioutil.NopCloser(strings.NewReader(endpoint.Body))
+		httpReq.ContentLength = int64(len(endpoint.Body))
+
+	} else if ct.inlinebodies && endpoint.Body != "" {
+		errormsg := new(ErrorMessage)
+		errormsg.input = endpoint.Id
+		errormsg.msg = "Body files are not supported, the body has to be JSON: " + endpoint.Body
+		errormsg.output = ""
+		return httpReq, errormsg
 
-	if _, err := os.Stat(endpoint.Body); err == nil {
+	} else if _, err := os.Stat(endpoint.Body); err == nil {
 		//httpReq.Header.Set("Content-Type", "application/json")
 		dat, err := ioutil.ReadFile(endpoint.Body)
 		if err != nil {
@@ -344,25 +481,19 @@ func (ct *ComplianceTest) buildRequest(endpoint Endpoint, token string, abs_url
 
 }
 
-// Validates a single endpoint defined as input parameter.
-// Returns the resulting state and an error message if something went wrong.
-func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *ErrorMessage) {
-	//log.Println(openapi3.SchemaStringFormats)
-	//openapi3.DefineStringFormat("url", `^[0-9a-f]{8}-[0-9a-f]{4}-[1-5][0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
-	//log.Println(openapi3.SchemaStringFormats)
-
-	if ct.debug == true {
-		log.Println("====Endpoint " + endpoint.Id + "====")
-	}
+// Checks if the body of an endpoint is a JSON object or array instead of the path to a body file
+func isInlineBody(body string) bool {
+	body = strings.TrimSpace(body)
+	return strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[")
+}
 
-	if token != "" {
-		if endpoint.Url == "/credentials/basic" {
-			return "Valid", nil
-		}
+// Loads the openEO API definition from the file or url given in the config and creates the router on it.
+// The router is created only once per compliance test instance.
+func (ct *ComplianceTest) loadRouter() (*openapi3filter.Router, *ErrorMessage) {
+	if ct.router != nil {
+		return ct.router, nil
 	}
 
-	_, err := os.Stat(ct.apifile)
-
 	// Try to read the openapi3 file
 	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(ct.apifile)
 
@@ -377,12 +508,48 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 		errormsg.input = string(ct.apifile)
 		errormsg.msg = "Error reading the openEO API, neighter file nor url found"
 		errormsg.output = string(err.Error())
-		return "Error", errormsg
+		return nil, errormsg
+	}
+
+	// Unknown formats of strings are only an error of the definition if formats are handled strictly
+	router := openapi3filter.NewRouter()
+	err = swagger.Validate(openapi3.ContextWithFormatMode(context.TODO(), ct.formats))
+	if err == nil {
+		err = router.AddSwagger(swagger)
+	}
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = string(ct.apifile)
+		errormsg.msg = "Error validating the openEO API"
+		errormsg.output = string(err.Error())
+		return nil, errormsg
 	}
 
-	router := openapi3filter.NewRouter().WithSwagger(swagger)
+	ct.swagger = swagger
 	ct.router = router
-	ctx := context.TODO()
+	return ct.router, nil
+}
+
+// Validates a single endpoint defined as input parameter.
+// Returns the resulting state and an error message if something went wrong.
+func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *ErrorMessage) {
+	if ct.debug == true {
+		log.Println("====Endpoint " + endpoint.Id + "====")
+	}
+
+	if token != "" {
+		if endpoint.Url == "/credentials/basic" {
+			return "Valid", nil
+		}
+	}
+
+	// The router is needed for the content type of the request body
+	_, errLoad := ct.loadRouter()
+
+	if errLoad != nil {
+		return "Error", errLoad
+	}
 
 	// Define Local Request for validation
 	httpReq, errReq := ct.buildRequest(endpoint, token, false)
@@ -408,48 +575,17 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 	// 	}
 	// }
 
-	// Find route in openAPI definition
-	route, pathParams, err := router.FindRoute(httpReq.Method, httpReq.URL)
-
-	if err != nil {
-		errormsg := new(ErrorMessage)
-		errormsg.input = string(httpReq.Method) + "  " + string(endpoint.Url)
-		errormsg.msg = "Error finding endpoint in the OpenAPI definition"
-		errormsg.output = err.Error()
-		return "Invalid", errormsg
-	}
-
-	// Options for the validation
-	options := &openapi3filter.Options{
-		AuthenticationFunc: func(c context.Context, input *openapi3filter.AuthenticationInput) error {
-			// TODO: support more schemes
-			sec := input.SecurityScheme
-			if sec.Type == "http" && sec.Scheme == "bearer" {
-				if httpReq.Header.Get("Authorization") == "" {
-					return nil //errors.New("Missing auth")
-				}
-			}
-			return nil
-		},
-	}
+	// Format mismatches of the request and the response, collected if formats only warn
+	var format_warnings []string
 
 	// Validate request
-	requestValidationInput := &openapi3filter.RequestValidationInput{
-		Request:    httpReq,
-		PathParams: pathParams,
-		Route:      route,
-		Options:    options}
-
-	if err := openapi3filter.ValidateRequest(ctx, requestValidationInput); err != nil {
-		errormsg := new(ErrorMessage)
-		errormsg.input = string(httpReq.Method) + "  " + string(endpoint.Url)
-		errormsg.msg = "Error validating the request"
-		errormsg.output = string(err.Error())
+	requestValidationInput, errormsg := ct.validateRequest(endpoint, httpReq, &format_warnings)
+	if errormsg != nil {
 		return "Invalid", errormsg
 	}
 
 	// Send request
-	client := &http.Client{}
+	client := ct.newClient(0)
 
 	// Set timeout if given
 	if endpoint.Timeout != 0 {
@@ -461,13 +597,13 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 
 	if ct.debug == true {
 		log.Println("---Request---")
-		log.Println("URL: ", string(execReq.URL.RequestURI()))
+		log.Println("URL: ", ct.mask(string(execReq.URL.RequestURI())))
 		log.Println("Method: ", execReq.Method)
-		jsonString, _ := json.Marshal(execReq.Header)
+		jsonString, _ := json.Marshal(ct.maskHeader(execReq.Header))
 		log.Println("Header: ", string(jsonString))
 		if execReq.Body != nil {
 			reqbody, _ := ioutil.ReadAll(execReq.Body)
-			log.Println("Body: ", string(reqbody))
+			log.Println("Body: ", ct.mask(string(reqbody)))
 			stringReader := strings.NewReader(string(reqbody))
 			stringReadCloser := ioutil.NopCloser(stringReader)
 			execReq.Body = stringReadCloser
@@ -480,6 +616,12 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 		return "Error", errReq
 	}
 
+	exchange := ct.recordRequest(endpoint, execReq)
+
+	if ct.interrupt != nil {
+		execReq = execReq.WithContext(ct.interrupt)
+	}
+	execReq, timing := traceRequest(execReq)
 	resp, err := client.Do(execReq)
 
 	if err != nil {
@@ -492,18 +634,21 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 
 	// Get Response
 	body, err := ioutil.ReadAll(resp.Body)
+	timing.finish(len(body))
+	exchange.recordResponse(resp, body)
+	exchange.Timing = timing
 
 	if ct.debug == true {
 		log.Println("---Response---")
 		log.Println("Status Code: ", resp.StatusCode)
-		jsonString, _ := json.Marshal(resp.Header)
+		jsonString, _ := json.Marshal(ct.maskHeader(resp.Header))
 		log.Println("Header: ", string(jsonString))
 		if body != nil {
 			//reqbody, _ := ioutil.ReadAll(httpReq.Body)
 			if len(body) < 1000 {
-				log.Printf("Body (length %d): %s\n", len(body), body)
+				log.Printf("Body (length %d): %s\n", len(body), ct.mask(string(body)))
 			} else {
-				log.Printf("Body (length %d): %q...\n", len(body), body[:1000])
+				log.Printf("Body (length %d): %q...\n", len(body), ct.mask(string(body[:1000])))
 			}
 		} else {
 			log.Println("Body: Empty")
@@ -514,7 +659,7 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 
 	if resp.StatusCode == 401 {
 		errormsg := new(ErrorMessage)
-		errormsg.input = "Header Auth: " + execReq.Header.Get("Authorization")
+		errormsg.input = "Header Auth: " + ct.maskHeader(execReq.Header).Get("Authorization")
 		errormsg.msg = "Error: Basic Authentication failed."
 		errormsg.output = string(body)
 		return "Invalid", errormsg
@@ -550,28 +695,11 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 		return "Error", errormsg
 	}
 
-	var (
-		respStatus = resp.StatusCode
-		respHeader = resp.Header
-		respBody   = string(body)
-	)
-
-	// Define validation input
-	responseValidationInput := &openapi3filter.ResponseValidationInput{
-		RequestValidationInput: requestValidationInput,
-		Status:                 respStatus,
-		Header:                 respHeader}
-
-	if respBody != "" {
-		responseValidationInput.SetBodyBytes([]byte(respBody))
-	}
+	// Resources are tracked for the cleanup even if the response is not valid
+	ct.trackResource(execReq.Method, endpoint.Url, resp.Header)
 
-	// Validate response.
-	if err := openapi3filter.ValidateResponse(ctx, responseValidationInput); err != nil {
-		errormsg := new(ErrorMessage)
-		//errormsg.input = "Response Body: " + string(body)
-		errormsg.msg = "Response of the back end not valid"
-		errormsg.output = err.Error()
+	// Validate response and check the assertions of the endpoint
+	if errormsg := ct.validateResponse(endpoint, requestValidationInput, resp, body, exchange); errormsg != nil {
 		return "Invalid", errormsg
 	}
 
@@ -593,39 +721,176 @@ func (ct *ComplianceTest) validate(endpoint Endpoint, token string) (string, *Er
 		}
 	}
 
-	return "Valid", nil
+	// Check the latency budget of the endpoint
+	var budget_warning string
+	if budget := time.Duration(endpoint.Max_duration * float64(time.Second)); budget > 0 && timing.Total > budget {
+		budget_warning = "Response took " + formatMilliseconds(timing.Total) + " ms, longer than max_duration of " + formatMilliseconds(budget) + " ms"
+		if ct.failonbudget {
+			errormsg := new(ErrorMessage)
+			errormsg.input = string(execReq.Method) + "  " + string(endpoint.Url)
+			errormsg.msg = "Latency budget exceeded"
+			errormsg.output = budget_warning
+			return "Invalid", errormsg
+		}
+	}
+
+	warnings := responseWarnings(requestValidationInput, resp, body, format_warnings)
+	if budget_warning != "" {
+		warnings = append(warnings, "max-duration: "+budget_warning)
+	}
+
+	return warningState(string(execReq.Method)+"  "+string(endpoint.Url), warnings)
+}
+
+// Validates a request, with an url relative to the back end, against the openEO API with the configured
+// handling of formats. Format warnings are added to the given list.
+// Returns the input for the validation of the response, or an error message if the request is invalid.
+func (ct *ComplianceTest) validateRequest(endpoint Endpoint, httpReq *http.Request, format_warnings *[]string) (*openapi3filter.RequestValidationInput, *ErrorMessage) {
+	// Find route in openAPI definition
+	route, pathParams, err := ct.router.FindRoute(httpReq.Method, httpReq.URL)
+
+	if err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = string(httpReq.Method) + "  " + string(endpoint.Url)
+		errormsg.msg = "Error finding endpoint in the OpenAPI definition"
+		errormsg.output = err.Error()
+		return nil, errormsg
+	}
+
+	// Options for the validation, the credentials are checked by the back end
+	options := &openapi3filter.Options{
+		SchemaOptions: ct.schemaOptions(format_warnings),
+		AuthenticationFunc: func(c context.Context, input *openapi3filter.AuthenticationInput) error {
+			return nil
+		},
+	}
+
+	requestValidationInput := &openapi3filter.RequestValidationInput{
+		Request:    httpReq,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    options}
+
+	if err := openapi3filter.ValidateRequest(context.TODO(), requestValidationInput); err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = string(httpReq.Method) + "  " + string(endpoint.Url)
+		errormsg.msg = "Error validating the request"
+		errormsg.output = string(err.Error())
+		return nil, errormsg
+	}
+
+	return requestValidationInput, nil
+}
+
+// Validates the response to a validated request against the openEO API and checks the assertions of the endpoint.
+// The JSON pointers of the errors are recorded in the exchange, if given.
+// Returns an error message if the response is invalid.
+func (ct *ComplianceTest) validateResponse(endpoint Endpoint, requestValidationInput *openapi3filter.RequestValidationInput, resp *http.Response, body []byte, exchange *Exchange) *ErrorMessage {
+	responseValidationInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestValidationInput,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header}
+
+	if len(body) > 0 {
+		responseValidationInput.SetBodyBytes(body)
+	}
+
+	// Check the assertions of the endpoint, failures are reported together with the schema errors
+	assertion_failures, pointers := checkAssertions(endpoint.Assert, body)
+	if exchange != nil {
+		exchange.Pointers = append(exchange.Pointers, pointers...)
+	}
+
+	if err := openapi3filter.ValidateResponse(context.TODO(), responseValidationInput); err != nil {
+		errormsg := new(ErrorMessage)
+		errormsg.input = requestValidationInput.Request.Method + "  " + endpoint.Url
+		errormsg.msg = "Response of the back end not valid"
+		errormsg.output = err.Error()
+		if len(assertion_failures) > 0 {
+			errormsg.output += "; Failed assertions: " + strings.Join(assertion_failures, "; ")
+		}
+		if exchange != nil {
+			exchange.recordError(err)
+		}
+		return errormsg
+	}
+
+	if len(assertion_failures) > 0 {
+		errormsg := new(ErrorMessage)
+		errormsg.input = requestValidationInput.Request.Method + "  " + endpoint.Url
+		errormsg.msg = "Assertions on the response failed"
+		errormsg.output = strings.Join(assertion_failures, "; ")
+		return errormsg
+	}
+
+	return nil
+}
+
+// Returns the warnings of a valid response: the violated recommendations of the openEO API and the format warnings
+func responseWarnings(requestValidationInput *openapi3filter.RequestValidationInput, resp *http.Response, body []byte, format_warnings []string) []string {
+	warnings := checkWarnings(WarningResponse{
+		Method:    requestValidationInput.Request.Method,
+		Path:      requestValidationInput.Route.Path,
+		Operation: requestValidationInput.Route.Operation,
+		Status:    resp.StatusCode,
+		Header:    resp.Header,
+		Body:      body})
+	for _, warning := range format_warnings {
+		warnings = append(warnings, "format: "+warning)
+	}
+	return warnings
+}
+
+// Returns the options of the schema validation for the configured handling of formats.
+// Format mismatches are added to warnings if formats only warn.
+func (ct *ComplianceTest) schemaOptions(warnings *[]string) []openapi3.SchemaValidationOption {
+	return []openapi3.SchemaValidationOption{
+		openapi3.FormatMode(ct.formats),
+		openapi3.FormatWarnings(func(err *openapi3.SchemaError) {
+			*warnings = append(*warnings, "/"+strings.Join(err.JSONPointer(), "/")+": "+err.Reason)
+		}),
+	}
 }
 
 // Reads info from config file
-func ReadConfig(config_file string) Config {
+func ReadConfig(config_file string) (Config, error) {
 	var configfile = config_file
-	var config Config
 
 	// Check if file exists
 	_, err := os.Stat(configfile)
 	if err != nil {
-		log.Fatal("Config file is missing: ", configfile)
+		return Config{}, fmt.Errorf("Config file is missing: %s", configfile)
 	}
 
-	// Read file if TOML File
+	data, err := ioutil.ReadFile(config_file)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error reading Config file: %v", err)
+	}
 
-	if _, err := toml.DecodeFile(configfile, &config); err != nil {
+	config, err := DecodeConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error reading Config file %s: %v", configfile, err)
+	}
 
-		//Read file as JSON File
-		data, err2 := ioutil.ReadFile(config_file)
+	return config, nil
+}
 
+// Decodes the content of a config file, first as TOML and if that fails as JSON
+func DecodeConfig(data []byte) (Config, error) {
+	var config Config
+
+	// Read file if TOML File
+	if _, err := toml.Decode(string(data), &config); err != nil {
+
+		//Read file as JSON File
+		config = Config{}
+		err2 := json.Unmarshal(data, &config)
 		if err2 != nil {
-			log.Println("Error reading Config file as TOML: ", err)
-			log.Fatal("Error reading Config file as JSON: ", err2)
-		}
-		err2 = json.Unmarshal(data, &config)
-		if err2 != nil {
-			log.Println("Error reading Config file as TOML: ", err)
-			log.Fatal("Error reading Config file as JSON:", err2)
+			return config, fmt.Errorf("Error reading Config file as TOML: %v; Error reading Config file as JSON: %v", err, err2)
 		}
 	}
 
-	return config
+	return config, nil
 }
 
 // Reads info from config file
@@ -662,7 +927,7 @@ func (be *BackEnd) loadUrl() {
 
 		// Get backend version
 		well_known := be.baseurl + "/.well-known/openeo"
-		client := &http.Client{}
+		client := &http.Client{Transport: be.transport}
 		httpReq, _ := http.NewRequest(http.MethodGet, well_known, nil)
 		resp, errResp := client.Do(httpReq)
 
@@ -735,7 +1000,7 @@ func (ct *ComplianceTest) loadCapabilities() {
 
 	capa_url := build_url(ct.backend.url, "/")
 	// log.Println(capa_url)
-	client := &http.Client{}
+	client := ct.newClient(0)
 	httpReq, _ := http.NewRequest(http.MethodGet, capa_url, nil)
 	resp, err := client.Do(httpReq)
 
@@ -760,6 +1025,9 @@ func (ct *ComplianceTest) loadCapabilities() {
 	var capa Capability
 	dec.Decode(&capa)
 
+	ct.advertised.Endpoints = make([]CapEndpoint, len(capa.Endpoints))
+	copy(ct.advertised.Endpoints, capa.Endpoints)
+
 	r := regexp.MustCompile(`{[^{}]*}`)
 	//log.Println(capa)
 
@@ -773,11 +1041,20 @@ func (ct *ComplianceTest) loadCapabilities() {
 
 }
 
-func (ct *ComplianceTest) appendConfig(config Config) {
+func (ct *ComplianceTest) appendConfig(config Config) error {
 
 	if config.Config != "" {
-		config_ext := ReadConfig(config.Config)
-		ct.appendConfig(config_ext)
+		config_ext, err := ReadConfig(config.Config)
+		if err != nil {
+			return err
+		}
+		if err := ct.appendConfig(config_ext); err != nil {
+			return err
+		}
+	}
+
+	if err := checkConfig(config); err != nil {
+		return err
 	}
 
 	if ct.variables == nil {
@@ -791,6 +1068,8 @@ func (ct *ComplianceTest) appendConfig(config Config) {
 		// ct.variables = config.Variables
 	}
 
+	ct.secrets = append(ct.secrets, config.Secrets...)
+
 	// for name, ep := range ct.variables {
 	// 	log.Println(name + " -- " + ep)
 	// }
@@ -802,12 +1081,72 @@ func (ct *ComplianceTest) appendConfig(config Config) {
 		ct.output = ReturnConfigValue(config.Output)
 	}
 
+	if config.History != "" {
+		ct.history = ReturnConfigValue(config.History)
+	}
+
 	if config.Backendversion != "" {
 		ct.backend.version = ReturnConfigValue(config.Backendversion)
 	}
 
 	ct.backend.loadUrl()
 
+	if config.Capabilitiesaudit {
+		ct.capabilitiesaudit = true
+	}
+
+	if config.Cors {
+		ct.cors = true
+	}
+
+	if config.Negativetests {
+		ct.negativetests = true
+	}
+
+	if config.Fuzz {
+		ct.fuzz = true
+	}
+
+	if config.Fuzzrequests != 0 {
+		ct.fuzzrequests = config.Fuzzrequests
+	}
+
+	if config.Fuzzduration != 0 {
+		ct.fuzzduration = config.Fuzzduration
+	}
+
+	if config.Fuzzseed != 0 {
+		ct.fuzzseed = config.Fuzzseed
+	}
+
+	if config.Formats != "" {
+		ct.formats, _ = formatMode(ReturnConfigValue(config.Formats))
+	}
+
+	if config.Failoninvalid {
+		ct.failoninvalid = true
+	}
+
+	if config.Failonwarnings {
+		ct.failonwarnings = true
+	}
+
+	if config.Failonbudget {
+		ct.failonbudget = true
+	}
+
+	if config.Autocleanup {
+		ct.autocleanup = true
+	}
+
+	for name, ep := range config.Cleanup {
+		if ep.Id == "" {
+			name_split := strings.Split(name, ".")
+			ep.Id = name_split[len(name_split)-1]
+		}
+		ct.cleanup = append(ct.cleanup, ep)
+	}
+
 	if config.Openapi != "" {
 		ct.apifile = ReturnConfigValue(config.Openapi)
 	}
@@ -867,15 +1206,204 @@ func (ct *ComplianceTest) appendConfig(config Config) {
 	}
 
 	ct.loadCapabilities()
+	return nil
 }
 
-// Main function
-func main() {
+// Checks the values of a config, which can not be loaded into a compliance test instance
+func checkConfig(config Config) error {
+	if config.Formats != "" {
+		if _, err := formatMode(ReturnConfigValue(config.Formats)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the handling of formats by its name in the config file or in the flags
+func formatMode(name string) (openapi3.FormatValidationMode, error) {
+	mode, ok := FORMAT_MODES[strings.ToLower(name)]
+	if !ok {
+		return mode, fmt.Errorf("Unknown handling of formats (strict, lenient or warn): %s", name)
+	}
+	return mode, nil
+}
+
+// Creates the validation report out of the states of the validated endpoints
+func (ct *ComplianceTest) buildReport(result map[string](map[string]string), start_time time.Time, end_time time.Time) Report {
+	result_json := make(Report)
+	result_json["result"] = make(map[string](map[string]interface{}))
+	result_json["stats"] = make(map[string](map[string]interface{}))
+	result_json["stats"]["backend"] = make(map[string]interface{})
+	result_json["stats"]["execution"] = make(map[string]interface{})
+	result_json["stats"]["spec"] = make(map[string]interface{})
+	result_json["stats"]["backend"]["url"] = ct.backend.url
+	result_json["stats"]["backend"]["baseurl"] = ct.backend.baseurl
+	result_json["stats"]["backend"]["version"] = ct.backend.version
+	result_json["stats"]["execution"]["start"] = start_time.Format("2006-01-02 15:04:05")
+	result_json["stats"]["execution"]["end"] = end_time.Format("2006-01-02 15:04:05")
+	result_json["stats"]["spec"]["apifile"] = ct.apifile
+
+	for group, endpoints := range ct.endpoints {
+		for _, ep := range endpoints {
+			ep.loadVariablesToEndpoint(*ct)
+			if result[ep.Id] == nil {
+				result[ep.Id] = make(map[string]string)
+			}
+			result[ep.Id]["url"] = ep.Url
+			result[ep.Id]["type"] = ep.Request_type
+			if exchange, ok := ct.exchanges[ep.Id]; ok && exchange.Timing != nil {
+				exchange.Timing.addTo(result[ep.Id])
+			}
+			result_json.addEndpoint(group, ep.Id, result[ep.Id])
+		}
+	}
+	result_json.addDurationPercentiles()
+
+	return result_json
+}
+
+// Adds the state of a single endpoint to a group of the report and updates the group summary
+func (result_json Report) addEndpoint(group string, id string, state map[string]string) {
+	if result_json["result"][group] == nil {
+		result_json["result"][group] = make(map[string]interface{})
+		result_json["result"][group]["group_summary"] = ""
+		result_json["result"][group]["endpoints"] = make(map[string](map[string]string))
+	}
+
+	result_json["result"][group]["endpoints"].(map[string](map[string]string))[id] = state
+	if state["state"] != "Valid" && state["state"] != "Warning" && state["state"] != "NotSupported" {
+		result_json["result"][group]["group_summary"] = "Invalid"
+	} else if state["state"] == "Warning" {
+		if result_json["result"][group]["group_summary"] != "Invalid" {
+			result_json["result"][group]["group_summary"] = "Warning"
+		}
+	} else if state["state"] == "Valid" {
+		if result_json["result"][group]["group_summary"] != "Invalid" && result_json["result"][group]["group_summary"] != "Warning" {
+			result_json["result"][group]["group_summary"] = "Valid"
+		}
+	} else if state["state"] == "NotSupported" && result_json["result"][group]["group_summary"] == "" {
+		result_json["result"][group]["group_summary"] = "NotSupported"
+	}
+}
+
+// Adds the states of several endpoints as one group to the report
+func (result_json Report) addGroup(group string, states map[string](map[string]string)) {
+	for id, state := range states {
+		result_json.addEndpoint(group, id, state)
+	}
+}
+
+// Returns the exit code of the run according to the group summaries of the report: EXIT_INVALID if a group
+// is invalid and invalid groups or warnings fail the run, EXIT_WARNING if a group has warnings and warnings
+// fail the run, 0 otherwise
+func (result_json Report) exitCode(fail_on_invalid bool, fail_on_warnings bool) int {
+	exit_code := 0
+	for _, group := range result_json["result"] {
+		if group["group_summary"] == "Invalid" && (fail_on_invalid || fail_on_warnings) {
+			return EXIT_INVALID
+		} else if group["group_summary"] == "Warning" && fail_on_warnings {
+			exit_code = EXIT_WARNING
+		}
+	}
+	return exit_code
+}
+
+// Runs the validation and all activated built-in checks of the compliance test instance.
+// Returns the resulting report
+func (ct *ComplianceTest) run() Report {
 	start_time := time.Now()
-	// Config file path
-	//var config Config
-	//var config_ep Config
 
+	// Run validation
+	result, err := ct.validateAll()
+
+	if err != nil {
+		log.Println(ct.mask(err.toString()))
+	}
+
+	end_time := time.Now()
+
+	result_json := ct.buildReport(result, start_time, end_time)
+
+	// The built-in checks are skipped if the run was interrupted, the cleanup runs in any case
+	if ct.interrupted() {
+		result_json["stats"]["execution"]["interrupted"] = true
+	} else {
+		if ct.capabilitiesaudit {
+			result_json.addGroup(AUDIT_GROUP, ct.auditCapabilities())
+		}
+
+		if ct.cors {
+			result_json.addGroup(CORS_GROUP, ct.validateCors())
+		}
+
+		if ct.negativetests {
+			result_json.addGroup(NEGATIVE_GROUP, ct.validateErrorHandling())
+		}
+
+		if ct.fuzz {
+			result_json.addGroup(FUZZ_GROUP, ct.validateFuzzing())
+		}
+	}
+
+	if cleanup := ct.runCleanup(); len(cleanup) > 0 {
+		result_json.addGroup(CLEANUP_GROUP, cleanup)
+	}
+
+	ct.maskReport(result_json)
+
+	return result_json
+}
+
+// Writes the report to the output file of the config or to the log, if no output file is set,
+// and to the history directory, if set
+func (ct *ComplianceTest) writeReport(result_json Report) {
+	output := ReturnConfigValue(ct.output)
+
+	if ct.format == "html" {
+		html := ct.renderHtmlReport(result_json)
+		// Write to stdout or to output file
+		if output == "" {
+			os.Stdout.Write(html)
+		} else {
+			ioutil.WriteFile(output, html, 0644)
+		}
+	} else {
+		jsonString, _ := json.MarshalIndent(result_json, "", "    ")
+
+		// Write to log stdout or to output file
+		if output == "" {
+			log.Println(string(jsonString))
+		} else {
+			ioutil.WriteFile(output, jsonString, 0644)
+		}
+	}
+
+	if ct.history != "" {
+		ct.saveHistory(result_json)
+	}
+}
+
+// Sets the options of the global flags for debugging, masking, the report format and failing on invalid groups and warnings
+func (ct *ComplianceTest) applyGlobalFlags(c *cli.Context) error {
+	if c.Bool("debug") {
+		ct.debug = true
+	}
+	ct.nomask = c.Bool("no-mask")
+	if c.Bool("fail-on-invalid") {
+		ct.failoninvalid = true
+	}
+	if c.Bool("fail-on-warnings") {
+		ct.failonwarnings = true
+	}
+	ct.format = c.String("format")
+	if ct.format != "json" && ct.format != "html" {
+		return fmt.Errorf("Unknown report format: %s", ct.format)
+	}
+	return nil
+}
+
+// Main function
+func main() {
 	ct := new(ComplianceTest)
 
 	// CLI handling
@@ -890,6 +1418,31 @@ func main() {
 			Name:  "debug",
 			Usage: "activate debug info",
 		},
+		&cli.BoolFlag{
+			Name:  "no-mask",
+			Usage: "do not mask credentials and secrets in logs and reports (for local debugging only)",
+		},
+		&cli.BoolFlag{
+			Name:  "fail-on-invalid",
+			Usage: "exit with code 2 if the back end is not valid against the openEO API",
+		},
+		&cli.BoolFlag{
+			Name:  "fail-on-warnings",
+			Usage: "exit with code 3 if the back end does not follow the recommendations of the openEO API",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "json",
+			Usage: "format of the validation report, json or html",
+		},
+		&cli.StringFlag{
+			Name:  "record",
+			Usage: "store all requests to the back end and their responses as HAR entries in the given directory",
+		},
+		&cli.StringFlag{
+			Name:  "replay",
+			Usage: "answer all requests with the responses recorded in the given directory instead of sending them to the back end",
+		},
 	}
 	// add config command
 	app.Commands = []*cli.Command{
@@ -898,18 +1451,58 @@ func main() {
 			Aliases: []string{"c"},
 			Usage:   "load from config file",
 			Action: func(c *cli.Context) error {
+				if err := ct.applyGlobalFlags(c); err != nil {
+					return err
+				}
+
+				// The transport has to be set before the configs are loaded, as they already request the back end
+				if c.String("record") != "" && c.String("replay") != "" {
+					return fmt.Errorf("Recording and replaying can not be combined")
+				} else if c.String("record") != "" {
+					transport, err := NewRecordingTransport(c.String("record"), ct)
+					if err != nil {
+						return err
+					}
+					ct.backend.transport = transport
+				} else if c.String("replay") != "" {
+					transport, err := NewReplayTransport(c.String("replay"), ct)
+					if err != nil {
+						return err
+					}
+					ct.backend.transport = transport
+				}
+
 				//configfile = c.Args().First()
 				for i := 0; i < c.Args().Len(); i++ {
-					ct.appendConfig(ReadConfig(c.Args().Get(i)))
+					config, err := ReadConfig(c.Args().Get(i))
+					if err != nil {
+						return err
+					}
+					if err := ct.appendConfig(config); err != nil {
+						return err
+					}
 
 				}
-				if c.Bool("debug") {
-					ct.debug = true
+
+				// config file read correctly
+				if ct.backend.url == "" {
+					log.Fatal("Error: No config file or backend url specified")
 				}
-				//log.Println("Configfile1: ", config.Url)
+
+				ct.interruptOnSignal()
+				result_json := ct.run()
+				ct.writeReport(result_json)
+				os.Exit(result_json.exitCode(ct.failoninvalid, ct.failonwarnings))
 				return nil
 			},
 		},
+		serveCommand(),
+		diffCommand(),
+		harCommand(),
+		proxyCommand(),
+		mockCommand(),
+		loadCommand(),
+		watchCommand(),
 	}
 
 	// run CLI
@@ -917,86 +1510,4 @@ func main() {
 	if apperr != nil {
 		log.Fatal(apperr)
 	}
-
-	//ct.debug = true
-	//ct.appendConfig(ReadConfig("examples/gee_config_v1_0_0_external.toml"))
-	//ct.appendConfig(ReadConfig("examples/D28/openeo_v1.0_endpoints.toml"))
-	//ct.appendConfig(ReadConfig("examples/D28/GEE_config.toml"))
-
-	//ct.debug = true
-	//ct.appendConfig(ReadConfig("examples/eodc_config_v1_0.toml"))
-	// ct.appendConfig(ReadConfig(c.Args().Get(i)))
-	//config = ReadConfig("examples/gee_config_v1_0.json")
-	//config = ReadConfig("examples/gee_config_v1_0_0_external.toml")
-	//config = ReadConfig("examples/eodc_config_v1_0.toml")
-
-	//config = ReadConfig("examples/gee_config_v1_0_0_external.toml")
-	// define back end and compliance test instance
-
-	//ct.appendConfig(config)
-	//ct.appendConfig(config_ep)
-
-	// config file read correctly
-	if ct.backend.url == "" {
-		log.Fatal("Error: No config file or backend url specified")
-	}
-
-	// Run validation
-	result, err := ct.validateAll()
-
-	if err != nil {
-		log.Println(err.toString())
-	}
-
-	end_time := time.Now()
-
-	var result_json map[string](map[string](map[string]interface{}))
-	result_json = make(map[string](map[string](map[string]interface{})))
-	result_json["result"] = make(map[string](map[string]interface{}))
-	result_json["stats"] = make(map[string](map[string]interface{}))
-	result_json["stats"]["backend"] = make(map[string]interface{})
-	result_json["stats"]["execution"] = make(map[string]interface{})
-	result_json["stats"]["spec"] = make(map[string]interface{})
-	result_json["stats"]["backend"]["url"] = ct.backend.url
-	result_json["stats"]["backend"]["baseurl"] = ct.backend.baseurl
-	result_json["stats"]["backend"]["version"] = ct.backend.version
-	result_json["stats"]["execution"]["start"] = start_time.Format("2006-01-02 15:04:05")
-	result_json["stats"]["execution"]["end"] = end_time.Format("2006-01-02 15:04:05")
-	result_json["stats"]["spec"]["apifile"] = ct.apifile
-
-	for group, endpoints := range ct.endpoints {
-		for _, ep := range endpoints {
-			ep.loadVariablesToEndpoint(*ct)
-			if result_json["result"][group] == nil {
-				result_json["result"][group] = make(map[string]interface{})
-				result_json["result"][group]["group_summary"] = ""
-				result_json["result"][group]["endpoints"] = make(map[string](map[string]string))
-			}
-
-			result_json["result"][group]["endpoints"].(map[string](map[string]string))[ep.Id] = result[ep.Id]
-			result_json["result"][group]["endpoints"].(map[string](map[string]string))[ep.Id]["url"] = ep.Url
-			result_json["result"][group]["endpoints"].(map[string](map[string]string))[ep.Id]["type"] = ep.Request_type
-			if result[ep.Id]["state"] != "Valid" && result[ep.Id]["state"] != "NotSupported" {
-				result_json["result"][group]["group_summary"] = "Invalid"
-			} else if result[ep.Id]["state"] == "Valid" {
-				if result_json["result"][group]["group_summary"] != "Invalid" {
-					result_json["result"][group]["group_summary"] = "Valid"
-				}
-			} else if result[ep.Id]["state"] == "NotSupported" && result_json["result"][group]["group_summary"] == "" {
-				result_json["result"][group]["group_summary"] = "NotSupported"
-			}
-		}
-	}
-
-	jsonString, _ := json.MarshalIndent(result_json, "", "    ")
-
-	output := ReturnConfigValue(ct.output)
-
-	// Write to log stdout or to output file
-	if output == "" {
-		log.Println(string(jsonString))
-	} else {
-		ioutil.WriteFile(output, jsonString, 0644)
-	}
-
 }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Group of the proxy report for requests not matching any operation of the openEO API
+const PROXY_UNKNOWN_GROUP = "Unknown operation"
+
+// Maximum size in bytes of the bodies validated by the proxy, larger bodies are passed without validation
+const PROXY_MAX_BODY = 10 << 20
+
+// Maximum number of requests in the report of the proxy, older requests are dropped
+const PROXY_MAX_REQUESTS = 10000
+
+// Maximum number of requests and responses kept for the HTML report of the proxy
+const PROXY_MAX_EXCHANGES = 100
+
+// ValidatingProxy "class", forwards requests to the back end and validates the requests and responses
+type ValidatingProxy struct {
+	ct      *ComplianceTest
+	backend *url.URL
+	proxy   *httputil.ReverseProxy
+	mutex   sync.Mutex
+	result  map[string](map[string]string)
+	counter int
+	// Latest requests in the report and ids of the latest requests kept for the HTML report, oldest first
+	requests  []Endpoint
+	exchanges []string
+	// Number of requests dropped from the report
+	dropped int
+}
+
+type proxyBodyKey struct{}
+
+// proxyRequestBody "class", the buffered body of a forwarded request, complete is false if it was too large
+type proxyRequestBody struct {
+	data     []byte
+	complete bool
+}
+
+// Creates the command to run the validator as validating reverse proxy
+func proxyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "proxy",
+		Usage: "forward the requests of openEO clients to the back end and validate the requests and responses",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "backend",
+				Usage: "url of the back end the requests are forwarded to",
+			},
+			&cli.StringFlag{
+				Name:  "openapi",
+				Usage: "file or url of the openEO API definition",
+			},
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: ":8080",
+				Usage: "address the proxy listens on",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "file the validation report is written to when the proxy is stopped",
+			},
+			&cli.StringFlag{
+				Name:  "formats",
+				Value: "lenient",
+				Usage: "handling of the formats of strings, strict, lenient or warn",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ct := new(ComplianceTest)
+			if err := ct.applyGlobalFlags(c); err != nil {
+				return err
+			}
+
+			if c.String("backend") == "" {
+				return fmt.Errorf("No backend url specified")
+			}
+			if c.String("openapi") == "" {
+				return fmt.Errorf("No openEO API definition specified")
+			}
+			ct.apifile = c.String("openapi")
+			ct.output = c.String("output")
+			formats, err := formatMode(c.String("formats"))
+			if err != nil {
+				return err
+			}
+			ct.formats = formats
+			ct.backend.baseurl = c.String("backend")
+			ct.backend.url = c.String("backend")
+			ct.variables = make(map[string]string)
+			ct.endpoints = make(map[string][]Endpoint)
+
+			if c.String("record") != "" {
+				transport, err := NewRecordingTransport(c.String("record"), ct)
+				if err != nil {
+					return err
+				}
+				ct.backend.transport = transport
+			}
+
+			proxy, err := NewValidatingProxy(ct)
+			if err != nil {
+				return err
+			}
+
+			server := &http.Server{Addr: c.String("listen"), Handler: proxy}
+			start_time := time.Now()
+
+			// The report is written when the proxy is stopped
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-stop
+				server.Shutdown(context.Background())
+			}()
+
+			log.Println("Forwarding", c.String("listen"), "to", ct.backend.url)
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				return err
+			}
+
+			report := proxy.report(start_time, time.Now())
+			ct.writeReport(report)
+			os.Exit(report.exitCode(ct.failoninvalid, ct.failonwarnings))
+			return nil
+		},
+	}
+}
+
+// Creates a proxy forwarding to the back end of the compliance test instance
+func NewValidatingProxy(ct *ComplianceTest) (*ValidatingProxy, error) {
+	if _, errLoad := ct.loadRouter(); errLoad != nil {
+		return nil, fmt.Errorf("%s", errLoad.toString())
+	}
+
+	backend, err := url.Parse(ct.backend.url)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid backend url: %v", err)
+	}
+
+	proxy := &ValidatingProxy{
+		ct:      ct,
+		backend: backend,
+		result:  make(map[string](map[string]string)),
+	}
+
+	proxy.proxy = httputil.NewSingleHostReverseProxy(backend)
+	director := proxy.proxy.Director
+	proxy.proxy.Director = func(req *http.Request) {
+		director(req)
+		// Back ends behind virtual hosts expect their own host name
+		req.Host = backend.Host
+	}
+	proxy.proxy.Transport = ct.backend.transport
+	proxy.proxy.ModifyResponse = proxy.validateResponse
+
+	return proxy, nil
+}
+
+// Buffers the body of the request, so that it can be validated after forwarding it.
+// Bodies larger than PROXY_MAX_BODY are streamed to the back end without validation.
+func (proxy *ValidatingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reqbody []byte
+	complete := true
+	if r.Body != nil && r.Method != http.MethodOptions {
+		buffer, err := ioutil.ReadAll(io.LimitReader(r.Body, PROXY_MAX_BODY+1))
+		if err != nil {
+			http.Error(w, "Error reading the request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(buffer) > PROXY_MAX_BODY {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buffer), r.Body), r.Body}
+			complete = false
+		} else {
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewReader(buffer))
+			reqbody = buffer
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), proxyBodyKey{}, proxyRequestBody{reqbody, complete}))
+	proxy.proxy.ServeHTTP(w, r)
+}
+
+// Passes the response to the client while it is received. The response is validated once it is
+// passed completely, violations are logged and added to the report.
+func (proxy *ValidatingProxy) validateResponse(resp *http.Response) error {
+	// CORS preflight requests of browsers are not part of the openEO API
+	if resp.Request.Method == http.MethodOptions {
+		return nil
+	}
+	resp.Body = &proxyResponseBody{
+		body: resp.Body,
+		done: func(body []byte, skipped string) {
+			proxy.validateExchange(resp, body, skipped)
+		},
+	}
+	return nil
+}
+
+// Validates the request and the response of the back end. Requests and responses that could not be
+// buffered completely are not validated, the reason is given by skipped.
+func (proxy *ValidatingProxy) validateExchange(resp *http.Response, body []byte, skipped string) {
+	// The request of the response is the forwarded one, the validation needs the path relative to the back end
+	reqbody, _ := resp.Request.Context().Value(proxyBodyKey{}).(proxyRequestBody)
+	relative_url := proxy.ct.relativePath(resp.Request.Method, resp.Request.URL, proxy.backend)
+	if resp.Request.URL.RawQuery != "" {
+		relative_url += "?" + resp.Request.URL.RawQuery
+	}
+	httpReq, err := http.NewRequest(resp.Request.Method, relative_url, bytes.NewReader(reqbody.data))
+	if err != nil {
+		return
+	}
+	httpReq.Header = resp.Request.Header.Clone()
+	if len(reqbody.data) == 0 {
+		httpReq.Body = nil
+	}
+	if !reqbody.complete {
+		skipped = "request body larger than " + strconv.Itoa(PROXY_MAX_BODY) + " bytes"
+	}
+
+	endpoint := Endpoint{
+		Url:          httpReq.URL.Path,
+		Request_type: httpReq.Method,
+		Group:        PROXY_UNKNOWN_GROUP,
+	}
+	if route, _, err := proxy.ct.router.FindRoute(httpReq.Method, httpReq.URL); err == nil {
+		endpoint.Group = route.Method + " " + route.Path
+	}
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	proxy.counter++
+	endpoint.Id = fmt.Sprintf("%04d", proxy.counter)
+
+	var state string
+	var errmsg *ErrorMessage
+	if skipped != "" {
+		state = "NotSupported"
+		errmsg = new(ErrorMessage)
+		errmsg.input = httpReq.Method + "  " + endpoint.Url
+		errmsg.msg = "Not validated, " + skipped
+	} else {
+		// The requests and responses are only kept for the HTML report
+		var exchange *Exchange
+		if proxy.ct.format == "html" {
+			exchange = proxy.ct.recordRequest(endpoint, httpReq)
+			exchange.recordResponse(resp, body)
+			proxy.exchanges = append(proxy.exchanges, endpoint.Id)
+			if len(proxy.exchanges) > PROXY_MAX_EXCHANGES {
+				delete(proxy.ct.exchanges, proxy.exchanges[0])
+				proxy.exchanges = proxy.exchanges[1:]
+			}
+		}
+		state, errmsg = proxy.ct.validateExchange(endpoint, httpReq, resp, body, exchange)
+	}
+
+	proxy.result[endpoint.Id] = map[string]string{"state": state, "message": ""}
+	if errmsg != nil {
+		proxy.result[endpoint.Id]["message"] = errmsg.toString()
+	}
+	if state != "Valid" && state != "NotSupported" {
+		log.Println(state+":", endpoint.Group, endpoint.Url, proxy.ct.mask(errmsg.toString()))
+	} else if proxy.ct.debug {
+		log.Println(state+":", endpoint.Group, endpoint.Url)
+	}
+	proxy.ct.endpoints[endpoint.Group] = append(proxy.ct.endpoints[endpoint.Group], endpoint)
+	proxy.ct.reportProgress(endpoint, proxy.result[endpoint.Id])
+
+	// Only the latest requests are kept, the oldest one is the first of its group
+	proxy.requests = append(proxy.requests, endpoint)
+	if len(proxy.requests) > PROXY_MAX_REQUESTS {
+		oldest := proxy.requests[0]
+		proxy.requests = proxy.requests[1:]
+		delete(proxy.result, oldest.Id)
+		delete(proxy.ct.exchanges, oldest.Id)
+		if proxy.ct.endpoints[oldest.Group] = proxy.ct.endpoints[oldest.Group][1:]; len(proxy.ct.endpoints[oldest.Group]) == 0 {
+			delete(proxy.ct.endpoints, oldest.Group)
+		}
+		proxy.dropped++
+	}
+}
+
+// proxyResponseBody "class", passes the body of a response to the client and keeps up to PROXY_MAX_BODY
+// bytes of it for the validation, which is done when the body is closed
+type proxyResponseBody struct {
+	body      io.ReadCloser
+	buffer    bytes.Buffer
+	truncated bool
+	eof       bool
+	closed    sync.Once
+	// Called with the body, or with the reason why the body can not be validated
+	done func(body []byte, skipped string)
+}
+
+func (body *proxyResponseBody) Read(p []byte) (int, error) {
+	n, err := body.body.Read(p)
+	if !body.truncated {
+		if body.buffer.Len()+n > PROXY_MAX_BODY {
+			body.truncated = true
+			body.buffer = bytes.Buffer{}
+		} else {
+			body.buffer.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		body.eof = true
+	}
+	return n, err
+}
+
+func (body *proxyResponseBody) Close() error {
+	err := body.body.Close()
+	body.closed.Do(func() {
+		if body.truncated {
+			body.done(nil, "response body larger than "+strconv.Itoa(PROXY_MAX_BODY)+" bytes")
+		} else if !body.eof {
+			body.done(nil, "response not passed completely to the client")
+		} else {
+			body.done(body.buffer.Bytes(), "")
+		}
+	})
+	return err
+}
+
+// Creates the report of all forwarded requests, with one group per operation of the openEO API
+func (proxy *ValidatingProxy) report(start_time time.Time, end_time time.Time) Report {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	report := proxy.ct.buildReport(proxy.result, start_time, end_time)
+	if proxy.dropped > 0 {
+		report["stats"]["execution"]["dropped_requests"] = proxy.dropped
+	}
+	proxy.ct.maskReport(report)
+	return report
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HarHeader "class", a header or query parameter of a HAR entry
+type HarHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HarPostData "class", the body of a request of a HAR entry. Binary bodies are base64 encoded like
+// the content of responses.
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HarContent "class", the body of a response of a HAR entry
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HarRequest "class", the request of a HAR entry
+type HarRequest struct {
+	Method      string       `json:"method"`
+	Url         string       `json:"url"`
+	HttpVersion string       `json:"httpVersion"`
+	Headers     []HarHeader  `json:"headers"`
+	QueryString []HarHeader  `json:"queryString"`
+	PostData    *HarPostData `json:"postData,omitempty"`
+}
+
+// HarResponse "class", the response of a HAR entry
+type HarResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HttpVersion string      `json:"httpVersion"`
+	Headers     []HarHeader `json:"headers"`
+	Content     HarContent  `json:"content"`
+}
+
+// HarEntry "class", a request and its response in the HTTP Archive (HAR) format
+type HarEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+}
+
+// Converts a header to HAR headers, sorted by name
+func toHarHeaders(header http.Header) []HarHeader {
+	har_headers := []HarHeader{}
+	for name, values := range header {
+		for _, value := range values {
+			har_headers = append(har_headers, HarHeader{Name: name, Value: value})
+		}
+	}
+	sort.Slice(har_headers, func(i, j int) bool { return har_headers[i].Name < har_headers[j].Name })
+	return har_headers
+}
+
+// Converts HAR headers to a header
+func fromHarHeaders(har_headers []HarHeader) http.Header {
+	header := make(http.Header)
+	for _, har_header := range har_headers {
+		header.Add(har_header.Name, har_header.Value)
+	}
+	return header
+}
+
+// RecordingTransport "class", sends requests to the back end and stores every request and its response
+// as HAR entry file in a directory
+type RecordingTransport struct {
+	dir     string
+	ct      *ComplianceTest
+	next    http.RoundTripper
+	mutex   sync.Mutex
+	counter int
+}
+
+// Creates a transport recording all requests of the compliance test instance into the directory
+func NewRecordingTransport(dir string, ct *ComplianceTest) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &RecordingTransport{dir: dir, ct: ct, next: http.DefaultTransport}, nil
+}
+
+func (transport *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := HarEntry{
+		StartedDateTime: time.Now().Format(time.RFC3339Nano),
+		Request: HarRequest{
+			Method:      req.Method,
+			Url:         transport.ct.mask(req.URL.String()),
+			HttpVersion: "HTTP/1.1",
+			Headers:     toHarHeaders(transport.ct.maskHeader(req.Header)),
+			QueryString: []HarHeader{},
+		},
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, HarHeader{Name: name, Value: transport.ct.mask(value)})
+		}
+	}
+
+	if req.Body != nil {
+		reqbody, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqbody))
+		text, encoding := transport.harText(reqbody)
+		entry.Request.PostData = &HarPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+
+	start := time.Now()
+	resp, err := transport.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	entry.Time = float64(time.Since(start)) / float64(time.Millisecond)
+
+	text, encoding := transport.harText(body)
+	entry.Response = HarResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HttpVersion: "HTTP/1.1",
+		Headers:     toHarHeaders(transport.ct.maskHeader(resp.Header)),
+		Content: HarContent{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		},
+	}
+
+	transport.save(entry)
+	return resp, nil
+}
+
+// Converts a body to the text of a HAR entry and its encoding. Text is masked, binary bodies
+// (e.g. GeoTIFF) are base64 encoded, as they are no valid UTF-8.
+func (transport *RecordingTransport) harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return transport.ct.mask(string(body)), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// Stores a HAR entry as numbered file, so that the order of the requests is kept
+func (transport *RecordingTransport) save(entry HarEntry) {
+	transport.mutex.Lock()
+	transport.counter++
+	counter := transport.counter
+	transport.mutex.Unlock()
+
+	name := regexp.MustCompile(`[^A-Za-z0-9.-]+`).ReplaceAllString(strings.Trim(entry.Request.Url[strings.Index(entry.Request.Url, "//")+2:], "/"), "_")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	file := filepath.Join(transport.dir, fmt.Sprintf("%04d_%s_%s.json", counter, entry.Request.Method, name))
+
+	data, _ := json.MarshalIndent(entry, "", "    ")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		log.Println("Warning: Failed to record request: ", file, err)
+	}
+}
+
+// ReplayTransport "class", answers requests with the responses recorded by a RecordingTransport,
+// without sending any request to the back end
+type ReplayTransport struct {
+	ct    *ComplianceTest
+	mutex sync.Mutex
+	// Recorded entries per method and url, in the order they were recorded
+	entries map[string][]HarEntry
+	// Number of replayed entries per method and url
+	replayed map[string]int
+}
+
+// Creates a transport replaying the HAR entry files of the directory for the compliance test instance
+func NewReplayTransport(dir string, ct *ComplianceTest) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No recorded requests found in directory: %s", dir)
+	}
+	sort.Strings(files)
+
+	transport := &ReplayTransport{
+		ct:       ct,
+		entries:  make(map[string][]HarEntry),
+		replayed: make(map[string]int),
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry HarEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("Error reading recorded request %s: %v", file, err)
+		}
+		key := entry.Request.Method + " " + entry.Request.Url
+		transport.entries[key] = append(transport.entries[key], entry)
+	}
+
+	return transport, nil
+}
+
+// Answers the request with the next recorded response for its method and url.
+// If all recorded responses were replayed, the last one is repeated.
+func (transport *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	// The urls are recorded with masked secrets
+	key := req.Method + " " + transport.ct.mask(req.URL.String())
+
+	transport.mutex.Lock()
+	entries := transport.entries[key]
+	index := transport.replayed[key]
+	if index < len(entries)-1 {
+		transport.replayed[key]++
+	}
+	transport.mutex.Unlock()
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("No recorded response for %s", key)
+	}
+
+	entry := entries[index]
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil {
+			return nil, fmt.Errorf("Error decoding the recorded response for %s: %v", key, err)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fromHarHeaders(entry.Response.Headers),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
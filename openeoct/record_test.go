@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReplayTransport(t *testing.T) {
+	ct := new(ComplianceTest)
+	err := ct.appendConfig(Config{
+		Url:     "https://openeo.example.com",
+		Openapi: "openapi_0_4_1.json",
+		Endpoints: map[string]Endpoint{
+			"processes":      {Url: "/processes", Group: "Processes"},
+			"output_formats": {Url: "/output_formats", Group: "Processes"},
+			"collections":    {Url: "/collections", Group: "Collections"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := NewReplayTransport("testdata/replay", ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.backend.transport = transport
+
+	report := ct.run()
+
+	tests := []struct {
+		group   string
+		id      string
+		state   string
+		message string
+	}{
+		{"Processes", "processes", "Valid", ""},
+		{"Processes", "output_formats", "Invalid", "Error at '/GTiff'"},
+		{"Collections", "collections", "Invalid", "No recorded response for GET https://openeo.example.com/collections"},
+	}
+	for _, test := range tests {
+		endpoints, _ := report["result"][test.group]["endpoints"].(map[string](map[string]string))
+		state := endpoints[test.id]
+		if state["state"] != test.state || !strings.Contains(state["message"], test.message) {
+			t.Errorf("%s %s = %s %q, expected %s with message containing %q", test.group, test.id, state["state"], state["message"], test.state, test.message)
+		}
+	}
+	if report["result"]["Processes"]["group_summary"] != "Invalid" {
+		t.Errorf("group_summary of Processes = %v, expected Invalid", report["result"]["Processes"]["group_summary"])
+	}
+}
+
+func TestRecordBinary(t *testing.T) {
+	// Start of a GeoTIFF, which is no valid UTF-8
+	geotiff := []byte{0x49, 0x49, 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00, 0xff, 0xfe, 0x80, 0x00}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/tiff")
+		w.Write(geotiff)
+	}))
+	defer backend.Close()
+
+	dir, err := ioutil.TempDir("", "openeoct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ct := new(ComplianceTest)
+	recording, err := NewRecordingTransport(dir, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, backend.URL+"/result", bytes.NewReader(geotiff))
+	resp, err := recording.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	replay, err := NewReplayTransport(dir, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entries := range replay.entries {
+		if entries[0].Request.PostData.Encoding != "base64" || entries[0].Response.Content.Encoding != "base64" {
+			t.Errorf("binary bodies recorded with encodings %q and %q, expected base64", entries[0].Request.PostData.Encoding, entries[0].Response.Content.Encoding)
+		}
+	}
+	req, _ = http.NewRequest(http.MethodPost, backend.URL+"/result", bytes.NewReader(geotiff))
+	resp, err = replay.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !bytes.Equal(body, geotiff) {
+		t.Errorf("replayed body = %v, expected %v", body, geotiff)
+	}
+}
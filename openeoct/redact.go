@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Replacement for credentials and secrets in logs and reports
+const MASK = "***"
+
+// Values of Authorization headers written as text, e.g. "Authorization: Basic dXNlcjpwYXNz"
+var AUTH_PATTERN = regexp.MustCompile(`(?i)(\bAuthorization\s*:\s*)[^\r\n"]+`)
+
+// Access tokens of openEO bearer tokens, e.g. "Bearer basic//token"
+var BEARER_PATTERN = regexp.MustCompile(`(?i)(\bBearer\s+basic//)[^\s"',;]+`)
+
+// Access tokens in JSON responses of the authentication endpoints
+var TOKEN_PATTERN = regexp.MustCompile(`("access_token"\s*:\s*)"[^"]*"`)
+
+// Headers that contain credentials
+var SECRET_HEADERS = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Returns the secrets of the compliance test instance: the password, the access token and the
+// values of the variables listed as secrets in the config. Longer secrets come first, so that
+// secrets containing other secrets are masked completely.
+func (ct *ComplianceTest) secretValues() []string {
+	var secrets []string
+	for _, secret := range []string{ct.password, ct.token} {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	for _, name := range ct.secrets {
+		if value := ct.variables[name]; value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	return secrets
+}
+
+// Replaces all credentials and secrets in the text with MASK, unless masking is disabled
+func (ct *ComplianceTest) mask(text string) string {
+	if ct.nomask {
+		return text
+	}
+	text = AUTH_PATTERN.ReplaceAllString(text, "${1}"+MASK)
+	text = BEARER_PATTERN.ReplaceAllString(text, "${1}"+MASK)
+	text = TOKEN_PATTERN.ReplaceAllString(text, `${1}"`+MASK+`"`)
+	for _, secret := range ct.secretValues() {
+		text = maskWord(text, secret)
+	}
+	return text
+}
+
+// Replaces the occurrences of the secret in the text with MASK, which are not part of a longer word,
+// so that short secrets do not mask parts of unrelated words
+func maskWord(text string, secret string) string {
+	first, _ := utf8.DecodeRuneInString(secret)
+	last, _ := utf8.DecodeLastRuneInString(secret)
+
+	var masked strings.Builder
+	start := 0
+	for {
+		i := strings.Index(text[start:], secret)
+		if i < 0 {
+			break
+		}
+		i += start
+		end := i + len(secret)
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+
+		masked.WriteString(text[start:i])
+		if (isWordRune(first) && isWordRune(before)) || (isWordRune(last) && isWordRune(after)) {
+			masked.WriteString(secret)
+		} else {
+			masked.WriteString(MASK)
+		}
+		start = end
+	}
+	masked.WriteString(text[start:])
+	return masked.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Returns a copy of the header with the values of credential headers and all secrets masked
+func (ct *ComplianceTest) maskHeader(header http.Header) http.Header {
+	masked := header.Clone()
+	if ct.nomask {
+		return masked
+	}
+	for _, name := range SECRET_HEADERS {
+		if masked.Get(name) != "" {
+			masked.Set(name, MASK)
+		}
+	}
+	for name, values := range masked {
+		for i := range values {
+			values[i] = ct.mask(values[i])
+		}
+		masked[name] = values
+	}
+	return masked
+}
+
+// Returns a copy of the state of an endpoint with all secrets masked
+func (ct *ComplianceTest) maskState(state map[string]string) map[string]string {
+	masked := make(map[string]string, len(state))
+	for key, value := range state {
+		masked[key] = ct.mask(value)
+	}
+	return masked
+}
+
+// Masks all secrets in the states of the endpoints of the report
+func (ct *ComplianceTest) maskReport(result_json Report) {
+	for _, group := range result_json["result"] {
+		endpoints, _ := group["endpoints"].(map[string](map[string]string))
+		for id, state := range endpoints {
+			endpoints[id] = ct.maskState(state)
+		}
+	}
+}
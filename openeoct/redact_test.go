@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	ct := new(ComplianceTest)
+	ct.password = "pass"
+	ct.token = "tok123"
+	ct.variables = map[string]string{"api_key": "k-9"}
+	ct.secrets = []string{"api_key"}
+
+	tests := []struct {
+		text   string
+		masked string
+	}{
+		{"Error: Basic Authentication failed.", "Error: Basic Authentication failed."},
+		{"Basic authentication is not supported", "Basic authentication is not supported"},
+		{"Authorization: Basic dXNlcjpwYXNz", "Authorization: ***"},
+		{`{"Authorization": "Bearer x"}`, `{"Authorization": "Bearer x"}`},
+		{"header Bearer basic//abc.def, next", "header Bearer basic//***, next"},
+		{`{"access_token": "abc"}`, `{"access_token": "***"}`},
+		{"user:pass@host", "user:***@host"},
+		{"password passes passport", "password passes passport"},
+		{"/jobs?token=tok123&x=1", "/jobs?token=***&x=1"},
+		{"key k-9, not k-99", "key ***, not k-99"},
+	}
+	for _, test := range tests {
+		if masked := ct.mask(test.text); masked != test.masked {
+			t.Errorf("mask(%q) = %q, expected %q", test.text, masked, test.masked)
+		}
+	}
+
+	ct.nomask = true
+	if masked := ct.mask("user:pass@host"); masked != "user:pass@host" {
+		t.Errorf("mask with nomask = %q", masked)
+	}
+}
+
+func TestMaskHeader(t *testing.T) {
+	ct := new(ComplianceTest)
+	ct.token = "tok123"
+	header := http.Header{}
+	header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	header.Set("X-Request", "id tok123")
+	header.Set("Content-Type", "application/json")
+
+	masked := ct.maskHeader(header)
+	if masked.Get("Authorization") != MASK || masked.Get("X-Request") != "id "+MASK || masked.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected masked header %v", masked)
+	}
+	if header.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+		t.Errorf("original header changed")
+	}
+}
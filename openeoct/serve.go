@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// States of a validation run
+const (
+	RUN_QUEUED   = "queued"
+	RUN_RUNNING  = "running"
+	RUN_FINISHED = "finished"
+	RUN_FAILED   = "failed"
+)
+
+// Openapi definitions of the server, which can be used by posted configs besides urls
+var SERVE_OPENAPI_FILES = map[string]bool{
+	"openapi_0_3_1.json": true,
+	"openapi_0_4_0.json": true,
+	"openapi_0_4_1.json": true,
+}
+
+// RunProgress "class", the state of a single endpoint validated during a run
+type RunProgress struct {
+	Id      string `json:"id"`
+	Group   string `json:"group"`
+	Url     string `json:"url"`
+	Type    string `json:"type"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+}
+
+// Run "class", a validation run started via the HTTP server
+type Run struct {
+	Id       string        `json:"id"`
+	State    string        `json:"state"`
+	Backend  string        `json:"backend"`
+	Created  string        `json:"created"`
+	Started  string        `json:"started,omitempty"`
+	Finished string        `json:"finished,omitempty"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+	Progress []RunProgress `json:"progress,omitempty"`
+	Report   Report        `json:"report,omitempty"`
+
+	configs []Config
+	// Closed and replaced on every change of the run
+	updated chan struct{}
+}
+
+// RunServer "class", queues validation runs posted via HTTP and stores them in a directory
+type RunServer struct {
+	store   string
+	debug   bool
+	mutex   sync.Mutex
+	runs    map[string]*Run
+	queue   chan *Run
+	counter int
+	// Canceled to stop the server, the running validation is interrupted and cleaned up
+	interrupt context.Context
+	// Closed once no more runs are executed, so that the event streams of queued runs end
+	stopped chan struct{}
+}
+
+// Creates the command to run the validator as HTTP server
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "run the validator as HTTP server, accepting configs and returning validation results",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: "localhost:8000",
+				Usage: "address the HTTP server listens on",
+			},
+			&cli.StringFlag{
+				Name:  "store",
+				Value: "runs",
+				Usage: "directory the validation runs are stored in",
+			},
+			&cli.IntFlag{
+				Name:  "queue",
+				Value: 100,
+				Usage: "maximum number of queued validation runs",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			server, err := NewRunServer(c.String("store"), c.Int("queue"))
+			if err != nil {
+				return err
+			}
+			server.debug = c.Bool("debug")
+
+			// The running validation is interrupted and cleaned up before the server shuts down
+			server.interrupt = notifyInterrupt()
+			httpServer := &http.Server{Addr: c.String("listen"), Handler: server.handler()}
+			go func() {
+				server.work()
+				// The shutdown waits for the open event streams, which end once the runs are stopped
+				close(server.stopped)
+				httpServer.Shutdown(context.Background())
+			}()
+
+			log.Println("Listening on", c.String("listen"))
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// Creates a run server storing the runs in the given directory and loads the runs stored previously.
+func NewRunServer(store string, queue_size int) (*RunServer, error) {
+	if err := os.MkdirAll(store, 0755); err != nil {
+		return nil, err
+	}
+
+	server := &RunServer{
+		store:     store,
+		runs:      make(map[string]*Run),
+		queue:     make(chan *Run, queue_size),
+		interrupt: context.Background(),
+		stopped:   make(chan struct{}),
+	}
+
+	files, err := filepath.Glob(filepath.Join(store, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Println("Warning: Failed to read stored run: ", file, err)
+			continue
+		}
+		run := new(Run)
+		if err := json.Unmarshal(data, run); err != nil {
+			log.Println("Warning: Failed to read stored run: ", file, err)
+			continue
+		}
+		// The configs are not stored, so unfinished runs can not be continued
+		if run.State == RUN_QUEUED || run.State == RUN_RUNNING {
+			run.State = RUN_FAILED
+			run.Error = "Server stopped before the run finished"
+		}
+		run.updated = make(chan struct{})
+		server.runs[run.Id] = run
+	}
+
+	return server, nil
+}
+
+func (server *RunServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", server.handleRuns)
+	mux.HandleFunc("/runs/", server.handleRun)
+	return mux
+}
+
+// Handles GET /runs, listing all runs without their results, and POST /runs, queueing a new run.
+// The body of a POST request is a config in TOML or JSON format or a JSON array of configs,
+// which are merged in the given order.
+func (server *RunServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		server.mutex.Lock()
+		runs := make([]Run, 0, len(server.runs))
+		for _, run := range server.runs {
+			summary := *run
+			summary.Progress = nil
+			summary.Report = nil
+			runs = append(runs, summary)
+		}
+		server.mutex.Unlock()
+
+		sort.Slice(runs, func(i, j int) bool { return runs[i].Created < runs[j].Created })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"runs": runs})
+
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Error reading the request body: "+err.Error())
+			return
+		}
+
+		configs, err := decodeConfigs(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		run, err := server.enqueue(configs)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", "/runs/"+run.Id)
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		writeJSON(w, http.StatusAccepted, run)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Handles GET /runs/{id}, returning the run with its results, and GET /runs/{id}/events, streaming
+// the progress of the run as server-sent events.
+func (server *RunServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+
+	server.mutex.Lock()
+	run, ok := server.runs[parts[0]]
+	server.mutex.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Run not found: "+parts[0])
+		return
+	}
+
+	if len(parts) == 1 {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "events" {
+		server.streamEvents(w, r, run)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Path not found: "+r.URL.Path)
+}
+
+// Streams the progress of a run as server-sent events: one "progress" event per validated endpoint
+// and a final "finished" event with the state of the run.
+func (server *RunServer) streamEvents(w http.ResponseWriter, r *http.Request, run *Run) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	stopping := false
+	for {
+		server.mutex.Lock()
+		progress := run.Progress[sent:]
+		sent = len(run.Progress)
+		done := run.State == RUN_FINISHED || run.State == RUN_FAILED
+		summary := *run
+		summary.Progress = nil
+		summary.Report = nil
+		updated := run.updated
+		server.mutex.Unlock()
+
+		for _, p := range progress {
+			writeEvent(w, "progress", p)
+		}
+		if done {
+			writeEvent(w, "finished", summary)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		// The progress up to the stop of the server is sent, the run is not executed anymore
+		if stopping {
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-server.stopped:
+			stopping = true
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Adds a run with the given configs to the queue.
+func (server *RunServer) enqueue(configs []Config) (*Run, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.interrupt.Err() != nil {
+		return nil, fmt.Errorf("Server is stopping, try again later")
+	}
+
+	server.counter++
+	now := time.Now()
+	run := &Run{
+		Id:       fmt.Sprintf("%s-%d", now.Format("20060102-150405"), server.counter),
+		State:    RUN_QUEUED,
+		Created:  now.Format("2006-01-02 15:04:05"),
+		Progress: []RunProgress{},
+		configs:  configs,
+		updated:  make(chan struct{}),
+	}
+
+	select {
+	case server.queue <- run:
+	default:
+		return nil, fmt.Errorf("Queue is full, try again later")
+	}
+
+	server.runs[run.Id] = run
+	server.save(run)
+	return run, nil
+}
+
+// Executes the queued runs one after another, until the server is interrupted. Runs still queued
+// then are marked as failed when the server starts again.
+func (server *RunServer) work() {
+	for {
+		select {
+		case <-server.interrupt.Done():
+			return
+		case run := <-server.queue:
+			if server.interrupt.Err() != nil {
+				return
+			}
+			server.execute(run)
+		}
+	}
+}
+
+// Executes a single run and stores the results.
+func (server *RunServer) execute(run *Run) {
+	server.update(run, func() {
+		run.State = RUN_RUNNING
+		run.Started = time.Now().Format("2006-01-02 15:04:05")
+	})
+
+	ct := new(ComplianceTest)
+	ct.debug = server.debug
+	// Variables may turn an inline body into the path of a file of the server
+	ct.inlinebodies = true
+	for _, config := range run.configs {
+		if err := ct.appendConfig(config); err != nil {
+			server.update(run, func() {
+				run.State = RUN_FAILED
+				run.Error = err.Error()
+				run.Finished = time.Now().Format("2006-01-02 15:04:05")
+			})
+			return
+		}
+	}
+
+	if ct.backend.url == "" {
+		server.update(run, func() {
+			run.State = RUN_FAILED
+			run.Error = "No backend url specified"
+			run.Finished = time.Now().Format("2006-01-02 15:04:05")
+		})
+		return
+	}
+
+	ct.progress = func(endpoint Endpoint, state map[string]string) {
+		server.update(run, func() {
+			run.Progress = append(run.Progress, RunProgress{
+				Id:      endpoint.Id,
+				Group:   endpoint.Group,
+				Url:     endpoint.Url,
+				Type:    endpoint.Request_type,
+				State:   state["state"],
+				Message: state["message"],
+			})
+		})
+	}
+
+	server.update(run, func() { run.Backend = ct.backend.url })
+	ct.interrupt = server.interrupt
+	report := ct.run()
+
+	server.update(run, func() {
+		run.Report = report
+		run.ExitCode = report.exitCode(ct.failoninvalid, ct.failonwarnings)
+		run.State = RUN_FINISHED
+		run.Finished = time.Now().Format("2006-01-02 15:04:05")
+		run.configs = nil
+	})
+}
+
+// Changes a run, stores it and notifies the event streams waiting for changes.
+func (server *RunServer) update(run *Run, change func()) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	change()
+	server.save(run)
+
+	close(run.updated)
+	run.updated = make(chan struct{})
+}
+
+// Stores a run as JSON file in the store directory, the mutex has to be locked by the caller.
+func (server *RunServer) save(run *Run) {
+	data, err := json.MarshalIndent(run, "", "    ")
+	if err != nil {
+		log.Println("Warning: Failed to store run: ", run.Id, err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(server.store, run.Id+".json"), data, 0644); err != nil {
+		log.Println("Warning: Failed to store run: ", run.Id, err)
+	}
+}
+
+// Decodes the configs of a run, either a single config in TOML or JSON format or a JSON array of configs.
+func decodeConfigs(body []byte) ([]Config, error) {
+	var configs []Config
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var raw_configs []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raw_configs); err != nil {
+			return nil, fmt.Errorf("Error reading the configs as JSON array: %v", err)
+		}
+		for _, raw_config := range raw_configs {
+			config, err := DecodeConfig(raw_config)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, config)
+		}
+	} else {
+		config, err := DecodeConfig(body)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	has_url := false
+	for _, config := range configs {
+		// Referenced config files would be read from the file system of the server
+		if config.Config != "" {
+			return nil, fmt.Errorf("Referencing config files is not supported, post all configs as JSON array instead")
+		}
+		if err := checkPostedConfig(config); err != nil {
+			return nil, err
+		}
+		if err := checkConfig(config); err != nil {
+			return nil, err
+		}
+		if config.Url != "" {
+			has_url = true
+		}
+	}
+	if !has_url {
+		return nil, fmt.Errorf("No backend url specified")
+	}
+
+	return configs, nil
+}
+
+// Checks that a posted config does not access the environment or the file system of the server:
+// environment variables, body files and files other than the openapi definitions of SERVE_OPENAPI_FILES
+// are rejected
+func checkPostedConfig(config Config) error {
+	values := map[string]string{
+		"url":            config.Url,
+		"openapi":        config.Openapi,
+		"username":       config.Username,
+		"password":       config.Password,
+		"authurl":        config.Authurl,
+		"backendversion": config.Backendversion,
+		"formats":        config.Formats,
+	}
+	for name, value := range config.Variables {
+		values["variables."+name] = value
+	}
+	for name, value := range values {
+		if strings.HasPrefix(value, "$") {
+			return fmt.Errorf("Environment variables are not supported in posted configs: %s", name)
+		}
+	}
+
+	if config.Output != "" || config.History != "" {
+		return fmt.Errorf("Writing the report to output or history files is not supported, the report is part of the run")
+	}
+	if config.Openapi != "" && !SERVE_OPENAPI_FILES[config.Openapi] &&
+		!strings.HasPrefix(config.Openapi, "http://") && !strings.HasPrefix(config.Openapi, "https://") {
+		return fmt.Errorf("The openapi definition has to be an url or one of the definitions of the server: %s", config.Openapi)
+	}
+
+	for name, endpoints := range map[string]map[string]Endpoint{"endpoints": config.Endpoints, "cleanup": config.Cleanup} {
+		for id, endpoint := range endpoints {
+			if endpoint.Body != "" && !isInlineBody(endpoint.Body) {
+				return fmt.Errorf("Body files are not supported in posted configs, the body of %s.%s has to be JSON", name, id)
+			}
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	data, _ := json.MarshalIndent(value, "", "    ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func writeEvent(w http.ResponseWriter, event string, value interface{}) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDecodeConfigs(t *testing.T) {
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`{"url": "https://openeo.example.com"}`, ""},
+		{`[{"url": "https://openeo.example.com"}, {"openapi": "openapi_0_4_1.json", "formats": "strict"}]`, ""},
+		{`{"url": "https://openeo.example.com", "openapi": "https://api.openeo.org/openapi.json"}`, ""},
+		{`{"url": "https://openeo.example.com", "endpoints": {"jobs": {"url": "/jobs", "request_type": "POST", "body": "{\"process_graph\": {}}"}}}`, ""},
+		{`{"openapi": "openapi_0_4_1.json"}`, "No backend url specified"},
+		{`{"url": "https://openeo.example.com", "config": "other.toml"}`, "Referencing config files"},
+		{`{"url": "https://openeo.example.com", "password": "$AWS_SECRET_ACCESS_KEY"}`, "Environment variables"},
+		{`{"url": "https://openeo.example.com", "variables": {"key": "$HOME"}}`, "variables.key"},
+		{`{"url": "https://openeo.example.com", "output": "/etc/report.json"}`, "output or history"},
+		{`{"url": "https://openeo.example.com", "history": "reports"}`, "output or history"},
+		{`{"url": "https://openeo.example.com", "openapi": "/etc/passwd"}`, "openapi definition"},
+		{`{"url": "https://openeo.example.com", "endpoints": {"jobs": {"url": "/jobs", "body": "/etc/passwd"}}}`, "endpoints.jobs"},
+		{`{"url": "https://openeo.example.com", "cleanup": {"job": {"url": "/jobs/1", "body": "job.json"}}}`, "cleanup.job"},
+		{`{"url": "https://openeo.example.com", "formats": "sloppy"}`, "Unknown handling of formats"},
+	}
+	for _, test := range tests {
+		_, err := decodeConfigs([]byte(test.body))
+		if test.err == "" && err != nil {
+			t.Errorf("decodeConfigs(%s) failed: %v", test.body, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("decodeConfigs(%s) = %v, expected error containing %q", test.body, err, test.err)
+		}
+	}
+}
+
+func TestExecuteBodyFromVariable(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		received = append(received, string(body))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	dir, err := ioutil.TempDir("", "openeoct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(secret, []byte("server secret"), 0600)
+
+	// The body is inline when posted, but the path of a file of the server after loading the variables
+	configs, err := decodeConfigs([]byte(`{"url": "` + backend.URL + `", "openapi": "openapi_0_4_1.json",
+		"variables": {"b": "` + secret + `"},
+		"endpoints": {"jobs": {"url": "/jobs", "request_type": "POST", "body": "{b}"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewRunServer(filepath.Join(dir, "runs"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := server.enqueue(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.execute(<-server.queue)
+
+	for _, body := range received {
+		if strings.Contains(body, "server secret") {
+			t.Errorf("file of the server sent to the back end: %s", body)
+		}
+	}
+	for _, progress := range run.Progress {
+		if progress.Id == "jobs" && (progress.State != "Error" || !strings.Contains(progress.Message, "Body files are not supported")) {
+			t.Errorf("endpoint with body file = %s %q, expected Error", progress.State, progress.Message)
+		}
+	}
+}
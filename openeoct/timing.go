@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Percentiles of the durations of the endpoints added to the groups of the report
+var DURATION_PERCENTILES = []int{50, 90, 95, 99}
+
+// Timing "class", the durations of the phases of a request and the size of the response body.
+// Phases not needed for the request (e.g. DNS and TLS for reused connections) are 0.
+type Timing struct {
+	Dns       time.Duration
+	Connect   time.Duration
+	Tls       time.Duration
+	FirstByte time.Duration
+	Total     time.Duration
+	Size      int
+
+	start time.Time
+	// The callbacks of the trace may be called concurrently, e.g. connecting to IPv4 and IPv6 addresses
+	mutex sync.Mutex
+}
+
+// Adds a trace to the request, which measures the phases of the request from now on
+func traceRequest(req *http.Request) (*http.Request, *Timing) {
+	timing := &Timing{start: time.Now()}
+	var dns_start, connect_start, tls_start time.Time
+
+	locked := func(f func()) {
+		timing.mutex.Lock()
+		defer timing.mutex.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { locked(func() { dns_start = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { locked(func() { timing.Dns = time.Since(dns_start) }) },
+		ConnectStart: func(network, addr string) {
+			locked(func() { connect_start = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			locked(func() { timing.Connect = time.Since(connect_start) })
+		},
+		TLSHandshakeStart: func() { locked(func() { tls_start = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			locked(func() { timing.Tls = time.Since(tls_start) })
+		},
+		GotFirstResponseByte: func() { locked(func() { timing.FirstByte = time.Since(timing.start) }) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), timing
+}
+
+// Ends the timing after the response body of the given size is read
+func (timing *Timing) finish(size int) {
+	timing.mutex.Lock()
+	defer timing.mutex.Unlock()
+	timing.Total = time.Since(timing.start)
+	timing.Size = size
+}
+
+// Adds the timing to the state of an endpoint in the report, durations in milliseconds and the size in bytes
+func (timing *Timing) addTo(state map[string]string) {
+	state["duration"] = formatMilliseconds(timing.Total)
+	state["dns"] = formatMilliseconds(timing.Dns)
+	state["connect"] = formatMilliseconds(timing.Connect)
+	state["tls"] = formatMilliseconds(timing.Tls)
+	state["ttfb"] = formatMilliseconds(timing.FirstByte)
+	state["size"] = strconv.Itoa(timing.Size)
+}
+
+func formatMilliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 1, 64)
+}
+
+// Adds the percentiles and the maximum of the durations of the endpoints to the groups with timed endpoints
+func (result_json Report) addDurationPercentiles() {
+	for _, group := range result_json["result"] {
+		endpoints, _ := group["endpoints"].(map[string](map[string]string))
+		var durations []float64
+		for _, state := range endpoints {
+			if duration, err := strconv.ParseFloat(state["duration"], 64); err == nil {
+				durations = append(durations, duration)
+			}
+		}
+		if len(durations) == 0 {
+			continue
+		}
+		sort.Float64s(durations)
+
+		percentiles := make(map[string]float64)
+		for _, p := range DURATION_PERCENTILES {
+			percentiles["p"+strconv.Itoa(p)] = percentile(durations, p)
+		}
+		percentiles["max"] = durations[len(durations)-1]
+		group["durations"] = percentiles
+	}
+}
+
+// Returns the nearest-rank percentile of the sorted values, 0 if there are none
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
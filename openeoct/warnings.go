@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Open-EO/openeo-backend-validator/openeoct/kin-openapi/openapi3"
+)
+
+// Exit code if at least one group of the report has warnings and warnings fail the run
+const EXIT_WARNING = 3
+
+// WarningResponse "class", a response checked against the recommendations of the openEO API
+type WarningResponse struct {
+	Method string
+	// Path of the openEO API, e.g. /jobs/{job_id}
+	Path string
+	// Operation of the openEO API, nil if the response is not checked against the openEO API
+	Operation *openapi3.Operation
+	Status    int
+	Header    http.Header
+	Body      []byte
+}
+
+// WarningRule "class", a recommendation (SHOULD requirement) of the openEO API.
+// Check returns a message for every violation of the recommendation by the response.
+type WarningRule struct {
+	Id    string
+	Check func(response WarningResponse) []string
+}
+
+// Recommendations of the openEO API checked on all responses that are valid otherwise.
+// Violations don't fail the validation, the endpoint gets the state "Warning" instead of "Valid".
+var WARNING_RULES = []WarningRule{
+	{Id: "error-content-type", Check: checkErrorContentType},
+	{Id: "links", Check: checkLinks},
+	{Id: "costs-header", Check: checkCostsHeader},
+	{Id: "capabilities-description", Check: checkCapabilitiesDescription},
+}
+
+// Checks the response against all warning rules.
+// Returns the violations, prefixed with the id of the rule
+func checkWarnings(response WarningResponse) []string {
+	var warnings []string
+	for _, rule := range WARNING_RULES {
+		for _, warning := range rule.Check(response) {
+			warnings = append(warnings, rule.Id+": "+warning)
+		}
+	}
+	return warnings
+}
+
+// Returns the state of a response with the given warnings:
+// "Warning" and an error message listing the warnings, or "Valid" if there are none
+func warningState(input string, warnings []string) (string, *ErrorMessage) {
+	if len(warnings) == 0 {
+		return "Valid", nil
+	}
+	errormsg := new(ErrorMessage)
+	errormsg.input = input
+	errormsg.msg = "Response does not follow the recommendations of the openEO API"
+	errormsg.output = strings.Join(warnings, "; ")
+	return "Warning", errormsg
+}
+
+// Error responses should be JSON openEO errors
+func checkErrorContentType(response WarningResponse) []string {
+	if response.Status < 400 {
+		return nil
+	}
+	content_type := response.Header.Get("Content-Type")
+	if content_type == "" {
+		return []string{"Error response without Content-Type instead of application/json"}
+	}
+	media_type, _, err := mime.ParseMediaType(content_type)
+	if err != nil || media_type != "application/json" {
+		return []string{"Error response with Content-Type '" + content_type + "' instead of application/json"}
+	}
+	return nil
+}
+
+// Responses should contain the links defined in the openEO API, even if they are optional
+func checkLinks(response WarningResponse) []string {
+	if response.Status < 200 || response.Status >= 300 || response.Operation == nil {
+		return nil
+	}
+	response_ref := response.Operation.Responses.Get(response.Status)
+	if response_ref == nil {
+		response_ref = response.Operation.Responses.Default()
+	}
+	if response_ref == nil || response_ref.Value == nil {
+		return nil
+	}
+	media_type := response_ref.Value.Content.Get("application/json")
+	if media_type == nil || media_type.Schema == nil || !hasProperty(media_type.Schema.Value, "links") {
+		return nil
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(response.Body, &body); err != nil {
+		return nil
+	}
+	if _, ok := body["links"]; !ok {
+		return []string{"Response without links"}
+	}
+	return nil
+}
+
+// Returns whether the schema, including the schemas it is composed of by allOf, defines the property
+func hasProperty(schema *openapi3.Schema, name string) bool {
+	if schema == nil {
+		return false
+	}
+	if _, ok := schema.Properties[name]; ok {
+		return true
+	}
+	for _, ref := range schema.AllOf {
+		if hasProperty(ref.Value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Synchronous processing should report its costs
+func checkCostsHeader(response WarningResponse) []string {
+	if response.Method != http.MethodPost || response.Path != "/result" || response.Status < 200 || response.Status >= 300 {
+		return nil
+	}
+	if response.Header.Get("OpenEO-Costs") == "" {
+		return []string{"Synchronous processing without OpenEO-Costs header"}
+	}
+	return nil
+}
+
+// The capabilities should describe the back end
+func checkCapabilitiesDescription(response WarningResponse) []string {
+	if response.Method != http.MethodGet || response.Path != "/" || response.Status != http.StatusOK {
+		return nil
+	}
+	var capabilities map[string]interface{}
+	if err := json.Unmarshal(response.Body, &capabilities); err != nil {
+		return nil
+	}
+	var warnings []string
+	for _, field := range []string{"title", "description"} {
+		if value, _ := capabilities[field].(string); strings.TrimSpace(value) == "" {
+			warnings = append(warnings, "Capabilities without "+field)
+		}
+	}
+	return warnings
+}
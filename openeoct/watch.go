@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Watcher "class", validates the back end of the configs on a schedule and keeps the latest results
+type Watcher struct {
+	configs  []Config
+	schedule Schedule
+	webhook  string
+	context  *cli.Context
+	// Canceled to stop watching
+	interrupt context.Context
+
+	mutex  sync.Mutex
+	report Report
+	// Timestamp of the latest run and its duration
+	last_run      time.Time
+	last_duration time.Duration
+	runs          int
+	// Latest time each endpoint was valid, keyed by group and id
+	last_success map[[2]string]time.Time
+}
+
+// Schedule "class", returns the time of the next run after the given time
+type Schedule interface {
+	next(after time.Time) time.Time
+}
+
+// IntervalSchedule "class", runs in a fixed interval
+type IntervalSchedule struct {
+	interval time.Duration
+}
+
+func (schedule IntervalSchedule) next(after time.Time) time.Time {
+	return after.Add(schedule.interval)
+}
+
+// CronSchedule "class", runs at the minutes matching a cron expression:
+// minute, hour, day of month, month and day of week with "*", numbers, ranges ("1-5"), lists ("0,30") and steps ("*/15")
+type CronSchedule struct {
+	fields [5]map[int]bool
+	// Day of month and day of week match either if both are restricted, like cron
+	any_day bool
+}
+
+// Ranges of the fields of a cron expression, 7 is Sunday like 0 in the day of week
+var CRON_RANGES = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// Parses a cron expression of 5 fields
+func ParseCron(expression string) (*CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Cron expression must have 5 fields: %s", expression)
+	}
+
+	schedule := &CronSchedule{}
+	for i, field := range fields {
+		values := make(map[int]bool)
+		for _, part := range strings.Split(field, ",") {
+			step := 1
+			if index := strings.Index(part, "/"); index >= 0 {
+				var err error
+				if step, err = strconv.Atoi(part[index+1:]); err != nil || step <= 0 {
+					return nil, fmt.Errorf("Invalid step in cron expression: %s", part)
+				}
+				part = part[:index]
+			}
+			low, high := CRON_RANGES[i][0], CRON_RANGES[i][1]
+			if part != "*" {
+				bounds := strings.SplitN(part, "-", 2)
+				var err error
+				if low, err = strconv.Atoi(bounds[0]); err != nil {
+					return nil, fmt.Errorf("Invalid value in cron expression: %s", part)
+				}
+				high = low
+				if len(bounds) == 2 {
+					if high, err = strconv.Atoi(bounds[1]); err != nil {
+						return nil, fmt.Errorf("Invalid range in cron expression: %s", part)
+					}
+				} else if step > 1 {
+					high = CRON_RANGES[i][1]
+				}
+				if low < CRON_RANGES[i][0] || high > CRON_RANGES[i][1] || low > high {
+					return nil, fmt.Errorf("Value out of range in cron expression: %s", part)
+				}
+			}
+			for value := low; value <= high; value += step {
+				values[value] = true
+			}
+		}
+		schedule.fields[i] = values
+	}
+	if schedule.fields[4][7] {
+		schedule.fields[4][0] = true
+	}
+	schedule.any_day = fields[2] != "*" && fields[4] != "*"
+	return schedule, nil
+}
+
+func (schedule *CronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every expression matches at least once in 4 years, e.g. on the 29th of February
+	for limit := t.AddDate(4, 0, 1); t.Before(limit); t = t.Add(time.Minute) {
+		day_of_month := schedule.fields[2][t.Day()]
+		day_of_week := schedule.fields[4][int(t.Weekday())]
+		day := day_of_month && day_of_week
+		if schedule.any_day {
+			day = day_of_month || day_of_week
+		}
+		if day && schedule.fields[3][int(t.Month())] && schedule.fields[1][t.Hour()] && schedule.fields[0][t.Minute()] {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Returns the watch command, which validates the back end on a schedule and serves the results as metrics
+func watchCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "watch",
+		Usage:     "validate the back end of the config files on a schedule and expose the results as metrics",
+		ArgsUsage: "CONFIG_FILE...",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "interval",
+				Value: 3600,
+				Usage: "seconds between the validation runs",
+			},
+			&cli.StringFlag{
+				Name:  "cron",
+				Usage: "cron expression of the validation runs (minute hour day month weekday), replaces the interval",
+			},
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: "localhost:9090",
+				Usage: "address the metrics and the latest report are served on",
+			},
+			&cli.StringFlag{
+				Name:  "webhook",
+				Usage: "url the changes of endpoints between valid and invalid are posted to",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() == 0 {
+				return fmt.Errorf("No config file specified")
+			}
+
+			watcher := &Watcher{
+				webhook:      c.String("webhook"),
+				context:      c,
+				last_success: make(map[[2]string]time.Time),
+			}
+			if c.String("cron") != "" {
+				schedule, err := ParseCron(c.String("cron"))
+				if err != nil {
+					return err
+				}
+				watcher.schedule = schedule
+			} else if c.Int("interval") <= 0 {
+				return fmt.Errorf("Interval must be positive")
+			} else {
+				watcher.schedule = IntervalSchedule{time.Duration(c.Int("interval")) * time.Second}
+			}
+			for i := 0; i < c.Args().Len(); i++ {
+				config, err := ReadConfig(c.Args().Get(i))
+				if err != nil {
+					return err
+				}
+				watcher.configs = append(watcher.configs, config)
+			}
+
+			// The running validation is interrupted and cleaned up before the server shuts down
+			watcher.interrupt = notifyInterrupt()
+			server := &http.Server{Addr: c.String("listen"), Handler: watcher}
+			finished := make(chan struct{})
+			go func() {
+				watcher.watch()
+				close(finished)
+			}()
+			go func() {
+				<-watcher.interrupt.Done()
+				<-finished
+				server.Shutdown(context.Background())
+			}()
+
+			log.Println("Serving metrics on", c.String("listen"))
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// Runs the validation right away and then on the schedule, until the watcher is interrupted
+func (watcher *Watcher) watch() {
+	for watcher.interrupt.Err() == nil {
+		start := time.Now()
+		if err := watcher.run(); err != nil {
+			log.Println("Error:", err)
+		}
+
+		next := watcher.schedule.next(start)
+		if next.IsZero() {
+			log.Println("Error: no further run matches the schedule")
+			return
+		}
+		if next.Before(time.Now()) {
+			// The run took longer than the interval, the missed runs are skipped
+			next = watcher.schedule.next(time.Now())
+		}
+		select {
+		case <-time.After(time.Until(next)):
+		case <-watcher.interrupt.Done():
+		}
+	}
+}
+
+// Validates the back end once with a new compliance test instance, stores the report and
+// emits the changes of endpoints between valid and invalid
+func (watcher *Watcher) run() error {
+	ct := new(ComplianceTest)
+	if err := ct.applyGlobalFlags(watcher.context); err != nil {
+		return err
+	}
+	for _, config := range watcher.configs {
+		if err := ct.appendConfig(config); err != nil {
+			return err
+		}
+	}
+	if ct.backend.url == "" {
+		return fmt.Errorf("No backend url specified")
+	}
+	// The history is restored before the first run, once the url of the back end is known
+	if watcher.runs == 0 {
+		watcher.loadHistory(ct)
+	}
+
+	ct.interrupt = watcher.interrupt
+	start := time.Now()
+	report := ct.run()
+	duration := time.Since(start)
+	// The report of an interrupted run is incomplete, the cleanup has run already
+	if ct.interrupted() {
+		return nil
+	}
+	// The report is only written if a file or the history is configured
+	if ReturnConfigValue(ct.output) != "" {
+		ct.writeReport(report)
+	} else if ct.history != "" {
+		ct.saveHistory(report)
+	}
+
+	watcher.mutex.Lock()
+	previous := watcher.report
+	watcher.report = report
+	watcher.last_run = start
+	watcher.last_duration = duration
+	watcher.runs++
+	for key, state := range reportEndpoints(toReportMap(report)) {
+		if isPassing(state["state"]) {
+			watcher.last_success[key] = start
+		}
+	}
+	watcher.mutex.Unlock()
+
+	log.Printf("Validation run finished in %s, exit code %d\n", duration.Round(time.Second), report.exitCode(ct.failoninvalid, ct.failonwarnings))
+
+	if previous != nil {
+		diff := diffReports(toReportMap(previous), toReportMap(report))
+		for _, change := range diff.Changes {
+			if change.Change == CHANGE_REGRESSED || change.Change == CHANGE_FIXED {
+				watcher.emit(change)
+			}
+		}
+	}
+	return nil
+}
+
+// Converts a report to the generic map of a report read from a file
+func toReportMap(report Report) map[string]interface{} {
+	var report_map map[string]interface{}
+	jsonString, _ := json.Marshal(report)
+	json.Unmarshal(jsonString, &report_map)
+	return report_map
+}
+
+// Restores the latest report of the back end from the history directory of the config, so that the
+// changes are detected across restarts
+func (watcher *Watcher) loadHistory(ct *ComplianceTest) {
+	if ct.history == "" {
+		return
+	}
+
+	files, _ := filepath.Glob(filepath.Join(ct.historyDir(), "*.json"))
+	if len(files) == 0 {
+		return
+	}
+	// The file names are timestamps, so the latest report is the last one
+	sort.Strings(files)
+	report_map, err := loadReport(files[len(files)-1])
+	if err != nil {
+		log.Println("Warning: Failed to restore the latest report:", err)
+		return
+	}
+	var report Report
+	jsonString, _ := json.Marshal(report_map)
+	if err := json.Unmarshal(jsonString, &report); err != nil {
+		return
+	}
+	watcher.mutex.Lock()
+	watcher.report = report
+	watcher.mutex.Unlock()
+}
+
+// Logs the change of an endpoint and posts it to the webhook, if set
+func (watcher *Watcher) emit(change ReportChange) {
+	log.Printf("State change: %s %s (%s %s) %s -> %s\n", change.Group, change.Id, change.Type, change.Url, change.OldState, change.NewState)
+	if watcher.webhook == "" {
+		return
+	}
+
+	jsonString, _ := json.Marshal(change)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(watcher.webhook, "application/json", bytes.NewReader(jsonString))
+	if err != nil {
+		log.Println("Warning: Failed to post state change to webhook:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Println("Warning: Webhook responded with status", resp.StatusCode)
+	}
+}
+
+// Serves the metrics at /metrics and the latest report at /report
+func (watcher *Watcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed: "+r.Method)
+		return
+	}
+	switch r.URL.Path {
+	case "/metrics":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(watcher.metrics())
+	case "/report":
+		watcher.mutex.Lock()
+		report := watcher.report
+		watcher.mutex.Unlock()
+		if report == nil {
+			writeError(w, http.StatusNotFound, "No validation run finished yet")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	default:
+		writeError(w, http.StatusNotFound, "Path not found: "+r.URL.Path)
+	}
+}
+
+// Renders the latest results in the text format of Prometheus
+func (watcher *Watcher) metrics() []byte {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "# HELP openeoct_runs_total Number of finished validation runs.")
+	fmt.Fprintln(buf, "# TYPE openeoct_runs_total counter")
+	fmt.Fprintf(buf, "openeoct_runs_total %d\n", watcher.runs)
+	if watcher.runs == 0 || watcher.report == nil {
+		return buf.Bytes()
+	}
+
+	fmt.Fprintln(buf, "# HELP openeoct_last_run_timestamp_seconds Start time of the latest validation run.")
+	fmt.Fprintln(buf, "# TYPE openeoct_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(buf, "openeoct_last_run_timestamp_seconds %d\n", watcher.last_run.Unix())
+	fmt.Fprintln(buf, "# HELP openeoct_last_run_duration_seconds Duration of the latest validation run.")
+	fmt.Fprintln(buf, "# TYPE openeoct_last_run_duration_seconds gauge")
+	fmt.Fprintf(buf, "openeoct_last_run_duration_seconds %g\n", watcher.last_duration.Seconds())
+
+	var groups []string
+	for group := range watcher.report["result"] {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	fmt.Fprintln(buf, "# HELP openeoct_group_state Summary of a group in the latest run, 1 for the current state.")
+	fmt.Fprintln(buf, "# TYPE openeoct_group_state gauge")
+	for _, group := range groups {
+		fmt.Fprintf(buf, "openeoct_group_state{group=%s,state=%s} 1\n",
+			metricLabel(group), metricLabel(fmt.Sprint(watcher.report["result"][group]["group_summary"])))
+	}
+
+	var states, durations, successes []string
+	for _, group := range groups {
+		endpoints, _ := watcher.report["result"][group]["endpoints"].(map[string](map[string]string))
+		var ids []string
+		for id := range endpoints {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			state := endpoints[id]
+			labels := fmt.Sprintf("group=%s,id=%s,method=%s,url=%s",
+				metricLabel(group), metricLabel(id), metricLabel(state["type"]), metricLabel(state["url"]))
+			states = append(states, fmt.Sprintf("openeoct_endpoint_state{%s,state=%s} 1", labels, metricLabel(state["state"])))
+			if duration, err := strconv.ParseFloat(state["duration"], 64); err == nil {
+				durations = append(durations, fmt.Sprintf("openeoct_endpoint_duration_seconds{%s} %g", labels, duration/1000))
+			}
+			if success, ok := watcher.last_success[[2]string{group, id}]; ok {
+				successes = append(successes, fmt.Sprintf("openeoct_endpoint_last_success_timestamp_seconds{%s} %d", labels, success.Unix()))
+			}
+		}
+	}
+
+	fmt.Fprintln(buf, "# HELP openeoct_endpoint_state State of an endpoint in the latest run, 1 for the current state.")
+	fmt.Fprintln(buf, "# TYPE openeoct_endpoint_state gauge")
+	fmt.Fprint(buf, joinLines(states))
+	fmt.Fprintln(buf, "# HELP openeoct_endpoint_duration_seconds Duration of the request of an endpoint in the latest run.")
+	fmt.Fprintln(buf, "# TYPE openeoct_endpoint_duration_seconds gauge")
+	fmt.Fprint(buf, joinLines(durations))
+	fmt.Fprintln(buf, "# HELP openeoct_endpoint_last_success_timestamp_seconds Start time of the latest run the endpoint was valid in.")
+	fmt.Fprintln(buf, "# TYPE openeoct_endpoint_last_success_timestamp_seconds gauge")
+	fmt.Fprint(buf, joinLines(successes))
+	return buf.Bytes()
+}
+
+// Quotes the value of a label of a metric
+func metricLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return `"` + value + `"`
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, _ := time.Parse("2006-01-02 15:04:05", value)
+		return parsed
+	}
+
+	tests := []struct {
+		expression string
+		after      string
+		next       string
+	}{
+		{"* * * * *", "2026-01-01 10:15:30", "2026-01-01 10:16:00"},
+		{"*/15 * * * *", "2026-01-01 10:16:00", "2026-01-01 10:30:00"},
+		{"*/15 * * * *", "2026-01-01 10:45:00", "2026-01-01 11:00:00"},
+		{"5/20 * * * *", "2026-01-01 10:26:00", "2026-01-01 10:45:00"},
+		{"0,30 9-17 * * *", "2026-01-01 09:10:00", "2026-01-01 09:30:00"},
+		{"0,30 9-17 * * *", "2026-01-01 17:30:00", "2026-01-02 09:00:00"},
+		{"0 8-18/5 * * *", "2026-01-01 13:00:00", "2026-01-01 18:00:00"},
+		{"0 12 * * 1-5", "2026-01-02 12:00:00", "2026-01-05 12:00:00"},
+		{"0 0 * * 0", "2026-01-01 00:00:00", "2026-01-04 00:00:00"},
+		{"0 0 * * 7", "2026-01-01 00:00:00", "2026-01-04 00:00:00"},
+		{"0 0 13 * *", "2026-01-01 00:00:00", "2026-01-13 00:00:00"},
+		{"0 0 * * 5", "2026-01-09 00:00:00", "2026-01-16 00:00:00"},
+		// Day of month and day of week restricted: either matches
+		{"0 0 13 * 5", "2026-01-01 00:00:00", "2026-01-02 00:00:00"},
+		{"0 0 13 * 5", "2026-01-09 00:00:00", "2026-01-13 00:00:00"},
+		{"0 0 13 * 5", "2026-01-13 00:00:00", "2026-01-16 00:00:00"},
+		// Day of week unrestricted: only the day of month matches
+		{"0 0 13 * *", "2026-01-02 00:00:00", "2026-01-13 00:00:00"},
+		{"0 0 1 */3 *", "2026-01-01 00:00:00", "2026-04-01 00:00:00"},
+		{"0 0 29 2 *", "2026-01-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 31 2 *", "2026-01-01 00:00:00", ""},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Errorf("ParseCron(%s) failed: %v", test.expression, err)
+			continue
+		}
+		next := schedule.next(at(test.after))
+		if test.next == "" && !next.IsZero() {
+			t.Errorf("next(%s) of %s = %v, expected no further run", test.after, test.expression, next)
+		} else if test.next != "" && !next.Equal(at(test.next)) {
+			t.Errorf("next(%s) of %s = %v, expected %s", test.after, test.expression, next, test.next)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"* * * *", "must have 5 fields"},
+		{"* * * * * *", "must have 5 fields"},
+		{"*/0 * * * *", "Invalid step"},
+		{"*/x * * * *", "Invalid step"},
+		{"a * * * *", "Invalid value"},
+		{"1-b * * * *", "Invalid range"},
+		{"60 * * * *", "Value out of range"},
+		{"5-1 * * * *", "Value out of range"},
+		{"* 24 * * *", "Value out of range"},
+		{"* * 0 * *", "Value out of range"},
+		{"* * * 13 *", "Value out of range"},
+		{"* * * * 8", "Value out of range"},
+	}
+	for _, test := range tests {
+		_, err := ParseCron(test.expression)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseCron(%s) = %v, expected error containing %q", test.expression, err, test.err)
+		}
+	}
+}